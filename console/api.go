@@ -2,6 +2,8 @@ package console
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -13,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/lib/pq"
+	"github.com/lokhman/yams/openapi"
 	"github.com/lokhman/yams/yams"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -28,6 +31,8 @@ const (
 	errCodeInvalidIdentifier
 	errCodeUsernameExists
 	errCodeInvalidAdapter
+	errCodeInvalidDocument
+	errCodeUnconvertibleScript
 )
 
 type hAPI struct{ *gin.RouterGroup }
@@ -45,6 +50,10 @@ func (_ *hAPI) error(c *gin.Context, code int, err error, vars gin.H) {
 	c.AbortWithStatusJSON(statusCode, out)
 }
 
+func (h *hAPI) badRequest(c *gin.Context, errorCode int, err error) {
+	h.error(c, code(http.StatusBadRequest, errorCode), err, nil)
+}
+
 func (h *hAPI) unauthorized(c *gin.Context, errorCode int, err error) {
 	c.Header("WWW-Authenticate", `Bearer realm="YAMS API"`)
 	h.error(c, code(http.StatusUnauthorized, errorCode), err, nil)
@@ -182,6 +191,23 @@ func (h *hAPI) checkRouteAccess(c *gin.Context, id int) bool {
 	return h.checkACLAccess(c, pid)
 }
 
+func (h *hAPI) checkJournalAccess(c *gin.Context, id int) bool {
+	if id == 0 {
+		h.notFound(c, errCodeInvalidIdentifier, nil)
+		return false
+	}
+	var pid int
+	q := qb.Select("profile_id").From("journal").Where("id = ?", id)
+	if err := q.Scan(&pid); err != nil {
+		if err == sql.ErrNoRows {
+			h.notFound(c, errCodeInvalidIdentifier, nil)
+			return false
+		}
+		panic(err)
+	}
+	return h.checkACLAccess(c, pid)
+}
+
 func (h *hAPI) getToken(c *gin.Context) string {
 	token := c.GetHeader("Authorization")
 	if token != "" && strings.HasPrefix(token, "Bearer ") {
@@ -253,6 +279,15 @@ func (h *hAPI) IndexAction(c *gin.Context) {
 	})
 }
 
+func (h *hAPI) CACertificateAction(c *gin.Context) {
+	ca, err := yams.LocalCA()
+	if err != nil {
+		panic(err)
+	}
+	c.Header("Content-Disposition", `attachment; filename="yams-ca.crt"`)
+	c.Data(200, "application/x-x509-ca-cert", ca.PEM())
+}
+
 func (h *hAPI) AuthAction(c *gin.Context) {
 	var in struct {
 		Username string `form:"username" json:"username" binding:"required,trim,username"`
@@ -469,13 +504,33 @@ func (h *hAPI) UsersDeleteAction(c *gin.Context) {
 }
 
 type outProfile struct {
-	Id           int            `json:"id"`
-	Name         string         `json:"name"`
-	Hosts        pq.StringArray `json:"hosts"`
-	Backend      *string        `json:"backend"`
-	IsDebug      bool           `json:"is_debug"`
-	VarsLifetime int            `json:"vars_lifetime"`
-	CreatedAt    time.Time      `json:"created_at"`
+	Id               int            `json:"id"`
+	Name             string         `json:"name"`
+	Hosts            pq.StringArray `json:"hosts"`
+	Backends         yams.Backends  `json:"backends"`
+	Balancing        yams.Balancing `json:"balancing"`
+	IsDebug          bool           `json:"is_debug"`
+	IsJournal        bool           `json:"is_journal"`
+	IsRecording      bool           `json:"is_recording"`
+	IsValidating     bool           `json:"is_validating"`
+	VarsLifetime     int            `json:"vars_lifetime"`
+	JournalLifetime  int            `json:"journal_lifetime"`
+	ValidationStatus *int           `json:"validation_status"`
+	Faults           yams.Faults    `json:"faults"`
+	Bandwidth        *int           `json:"bandwidth"`
+	TTFB             *int           `json:"ttfb"`
+	DescriptorSet    *string        `json:"descriptor_set"`
+	GraphQLSchema    *string        `json:"graphql_schema"`
+	TLSCert          *string        `json:"tls_cert"`
+	TLSKey           *string        `json:"tls_key"`
+	ClientAuth       *string        `json:"client_auth"`
+	ClientCA         *string        `json:"client_ca"`
+	Upstream         yams.Upstream  `json:"upstream"`
+	HTTPAllowlist    pq.StringArray `json:"http_allowlist"`
+	CreatedAt        time.Time      `json:"created_at"`
+
+	// Health of the backends is reported by the proxy.
+	Health []yams.BackendState `json:"health"`
 }
 
 func (h *hAPI) ProfilesAction(c *gin.Context) {
@@ -484,7 +539,7 @@ func (h *hAPI) ProfilesAction(c *gin.Context) {
 		return
 	}
 
-	q := qb.Select("id", "name", "hosts", "backend", "is_debug", "vars_lifetime", "created_at").From("profiles").OrderBy("name")
+	q := qb.Select("id", "name", "hosts", "backends", "balancing", "is_debug", "is_journal", "is_recording", "is_validating", "vars_lifetime", "journal_lifetime", "validation_status", "faults", "bandwidth", "ttfb", "descriptor_set", "graphql_schema", "tls_cert", "tls_key", "client_auth", "client_ca", "upstream", "http_allowlist", "created_at").From("profiles").OrderBy("name")
 	if acl := c.MustGet("acl").([]int64); acl != nil {
 		q.Where(sqrl.Eq{"id": acl})
 	}
@@ -494,9 +549,10 @@ func (h *hAPI) ProfilesAction(c *gin.Context) {
 	rs := make([]outProfile, 0)
 	for rows.Next() {
 		var out outProfile
-		if err = rows.Scan(&out.Id, &out.Name, &out.Hosts, &out.Backend, &out.IsDebug, &out.VarsLifetime, &out.CreatedAt); err != nil {
+		if err = rows.Scan(&out.Id, &out.Name, &out.Hosts, &out.Backends, &out.Balancing, &out.IsDebug, &out.IsJournal, &out.IsRecording, &out.IsValidating, &out.VarsLifetime, &out.JournalLifetime, &out.ValidationStatus, &out.Faults, &out.Bandwidth, &out.TTFB, &out.DescriptorSet, &out.GraphQLSchema, &out.TLSCert, &out.TLSKey, &out.ClientAuth, &out.ClientCA, &out.Upstream, &out.HTTPAllowlist, &out.CreatedAt); err != nil {
 			panic(err)
 		}
+		out.Health = yams.BalancerStates(out.Id)
 		rs = append(rs, out)
 	}
 	if err = rows.Err(); err != nil {
@@ -540,20 +596,38 @@ func (h *hAPI) ProfilesViewAction(c *gin.Context) {
 	}
 
 	var out outProfile
-	q := qb.Select("id", "name", "hosts", "backend", "is_debug", "vars_lifetime", "created_at").From("profiles").Where("id = ?", id)
-	if err := q.Scan(&out.Id, &out.Name, &out.Hosts, &out.Backend, &out.IsDebug, &out.VarsLifetime, &out.CreatedAt); err != nil {
+	q := qb.Select("id", "name", "hosts", "backends", "balancing", "is_debug", "is_journal", "is_recording", "is_validating", "vars_lifetime", "journal_lifetime", "validation_status", "faults", "bandwidth", "ttfb", "descriptor_set", "graphql_schema", "tls_cert", "tls_key", "client_auth", "client_ca", "upstream", "http_allowlist", "created_at").From("profiles").Where("id = ?", id)
+	if err := q.Scan(&out.Id, &out.Name, &out.Hosts, &out.Backends, &out.Balancing, &out.IsDebug, &out.IsJournal, &out.IsRecording, &out.IsValidating, &out.VarsLifetime, &out.JournalLifetime, &out.ValidationStatus, &out.Faults, &out.Bandwidth, &out.TTFB, &out.DescriptorSet, &out.GraphQLSchema, &out.TLSCert, &out.TLSKey, &out.ClientAuth, &out.ClientCA, &out.Upstream, &out.HTTPAllowlist, &out.CreatedAt); err != nil {
 		panic(err)
 	}
+	out.Health = yams.BalancerStates(out.Id)
 	h.ok(c, out)
 }
 
 type inProfile struct {
-	id           int
-	Name         string   `form:"name" json:"name" binding:"required,trim,min=3,max=72"`
-	Hosts        []string `form:"hosts" json:"hosts" binding:"required,min=1,dive,required,trim,max=128,host"`
-	Backend      *string  `form:"backend" json:"backend" binding:"omitempty,required,trim,max=128,url"`
-	IsDebug      bool     `form:"is_debug" json:"is_debug" binding:"omitempty"`
-	VarsLifetime int      `form:"vars_lifetime" json:"vars_lifetime" binding:"required,min=1,max=2147483647"`
+	id               int
+	Name             string         `form:"name" json:"name" binding:"required,trim,min=3,max=72"`
+	Hosts            []string       `form:"hosts" json:"hosts" binding:"required,min=1,dive,required,trim,max=128,host"`
+	Backends         yams.Backends  `form:"-" json:"backends" binding:"omitempty,max=16,dive"`
+	Balancing        yams.Balancing `form:"-" json:"balancing"`
+	IsDebug          bool           `form:"is_debug" json:"is_debug" binding:"omitempty"`
+	IsJournal        bool           `form:"is_journal" json:"is_journal" binding:"omitempty"`
+	IsRecording      bool           `form:"is_recording" json:"is_recording" binding:"omitempty"`
+	IsValidating     bool           `form:"is_validating" json:"is_validating" binding:"omitempty"`
+	VarsLifetime     int            `form:"vars_lifetime" json:"vars_lifetime" binding:"required,min=1,max=2147483647"`
+	JournalLifetime  int            `form:"journal_lifetime" json:"journal_lifetime" binding:"required,min=1,max=2147483647"`
+	ValidationStatus *int           `form:"validation_status" json:"validation_status" binding:"omitempty,min=100,max=599"`
+	Faults           yams.Faults    `form:"-" json:"faults" binding:"omitempty,max=16,dive"`
+	Bandwidth        *int           `form:"bandwidth" json:"bandwidth" binding:"omitempty,min=1,max=2147483647"`
+	TTFB             *int           `form:"ttfb" json:"ttfb" binding:"omitempty,min=0,max=3600000"`
+	DescriptorSet    *string        `form:"descriptor_set" json:"descriptor_set" binding:"omitempty,required,trim,max=72"`
+	GraphQLSchema    *string        `form:"graphql_schema" json:"graphql_schema" binding:"omitempty,required,trim,max=72"`
+	TLSCert          *string        `form:"tls_cert" json:"tls_cert" binding:"omitempty,required,trim,max=72"`
+	TLSKey           *string        `form:"tls_key" json:"tls_key" binding:"omitempty,required,trim,max=72"`
+	ClientAuth       *string        `form:"client_auth" json:"client_auth" binding:"omitempty,oneof=request require"`
+	ClientCA         *string        `form:"client_ca" json:"client_ca" binding:"omitempty,required,trim,max=72"`
+	Upstream         yams.Upstream  `form:"-" json:"upstream"`
+	HTTPAllowlist    []string       `form:"http_allowlist" json:"http_allowlist" binding:"omitempty,max=32,dive,required,trim,max=128,hostpattern"`
 }
 
 func (h *hAPI) ProfilesCreateAction(c *gin.Context) {
@@ -564,11 +638,28 @@ func (h *hAPI) ProfilesCreateAction(c *gin.Context) {
 
 	var id int
 	q := qb.Insert("profiles").SetMap(gin.H{
-		"name":          in.Name,
-		"hosts":         pq.StringArray(in.Hosts),
-		"backend":       in.Backend,
-		"is_debug":      in.IsDebug,
-		"vars_lifetime": in.VarsLifetime,
+		"name":              in.Name,
+		"hosts":             pq.StringArray(in.Hosts),
+		"backends":          in.Backends,
+		"balancing":         in.Balancing,
+		"is_debug":          in.IsDebug,
+		"is_journal":        in.IsJournal,
+		"is_recording":      in.IsRecording,
+		"is_validating":     in.IsValidating,
+		"vars_lifetime":     in.VarsLifetime,
+		"journal_lifetime":  in.JournalLifetime,
+		"validation_status": in.ValidationStatus,
+		"faults":            in.Faults,
+		"bandwidth":         in.Bandwidth,
+		"ttfb":              in.TTFB,
+		"descriptor_set":    in.DescriptorSet,
+		"graphql_schema":    in.GraphQLSchema,
+		"tls_cert":          in.TLSCert,
+		"tls_key":           in.TLSKey,
+		"client_auth":       in.ClientAuth,
+		"client_ca":         in.ClientCA,
+		"upstream":          in.Upstream,
+		"http_allowlist":    pq.StringArray(in.HTTPAllowlist),
 	}).Suffix("RETURNING id")
 	if err := q.Scan(&id); err != nil {
 		panic(err)
@@ -588,11 +679,28 @@ func (h *hAPI) ProfilesUpdateAction(c *gin.Context) {
 	}
 
 	q := qb.Update("profiles").SetMap(gin.H{
-		"name":          in.Name,
-		"hosts":         pq.StringArray(in.Hosts),
-		"backend":       in.Backend,
-		"is_debug":      in.IsDebug,
-		"vars_lifetime": in.VarsLifetime,
+		"name":              in.Name,
+		"hosts":             pq.StringArray(in.Hosts),
+		"backends":          in.Backends,
+		"balancing":         in.Balancing,
+		"is_debug":          in.IsDebug,
+		"is_journal":        in.IsJournal,
+		"is_recording":      in.IsRecording,
+		"is_validating":     in.IsValidating,
+		"vars_lifetime":     in.VarsLifetime,
+		"journal_lifetime":  in.JournalLifetime,
+		"validation_status": in.ValidationStatus,
+		"faults":            in.Faults,
+		"bandwidth":         in.Bandwidth,
+		"ttfb":              in.TTFB,
+		"descriptor_set":    in.DescriptorSet,
+		"graphql_schema":    in.GraphQLSchema,
+		"tls_cert":          in.TLSCert,
+		"tls_key":           in.TLSKey,
+		"client_auth":       in.ClientAuth,
+		"client_ca":         in.ClientCA,
+		"upstream":          in.Upstream,
+		"http_allowlist":    pq.StringArray(in.HTTPAllowlist),
 	}).Where("id = ?", id)
 	if _, err := q.Exec(); err != nil {
 		panic(err)
@@ -614,15 +722,19 @@ func (h *hAPI) ProfilesDeleteAction(c *gin.Context) {
 }
 
 type outRoute struct {
-	Id         int            `json:"id"`
-	Uuid       string         `json:"uuid"`
-	Path       string         `json:"path"`
-	Methods    pq.StringArray `json:"methods"`
-	Adapter    string         `json:"adapter"`
-	ScriptSize int            `json:"script_size"`
-	Timeout    int            `json:"timeout"`
-	Hint       *string        `json:"hint,omitempty"`
-	IsEnabled  bool           `json:"is_enabled"`
+	Id         int                  `json:"id"`
+	Uuid       string               `json:"uuid"`
+	Path       string               `json:"path"`
+	Methods    pq.StringArray       `json:"methods"`
+	Conditions yams.RouteConditions `json:"conditions"`
+	Faults     yams.Faults          `json:"faults"`
+	Bandwidth  *int                 `json:"bandwidth"`
+	TTFB       *int                 `json:"ttfb"`
+	Adapter    string               `json:"adapter"`
+	ScriptSize int                  `json:"script_size"`
+	Timeout    int                  `json:"timeout"`
+	Hint       *string              `json:"hint,omitempty"`
+	IsEnabled  bool                 `json:"is_enabled"`
 }
 
 func (h *hAPI) RoutesAction(c *gin.Context) {
@@ -631,7 +743,7 @@ func (h *hAPI) RoutesAction(c *gin.Context) {
 		return
 	}
 
-	q := qb.Select("id", "uuid", "path", "methods", "adapter", "octet_length(script)", "timeout", "hint", "is_enabled").
+	q := qb.Select("id", "uuid", "path", "methods", "conditions", "faults", "adapter", "octet_length(script)", "timeout", "bandwidth", "ttfb", "hint", "is_enabled").
 		From("routes").Where("profile_id = ?", pid).OrderBy("position")
 	rows, err := q.Query()
 	defer rows.Close()
@@ -639,7 +751,7 @@ func (h *hAPI) RoutesAction(c *gin.Context) {
 	rs := make([]outRoute, 0)
 	for rows.Next() {
 		var out outRoute
-		if err = rows.Scan(&out.Id, &out.Uuid, &out.Path, &out.Methods, &out.Adapter, &out.ScriptSize, &out.Timeout, &out.Hint, &out.IsEnabled); err != nil {
+		if err = rows.Scan(&out.Id, &out.Uuid, &out.Path, &out.Methods, &out.Conditions, &out.Faults, &out.Adapter, &out.ScriptSize, &out.Timeout, &out.Bandwidth, &out.TTFB, &out.Hint, &out.IsEnabled); err != nil {
 			panic(err)
 		}
 		rs = append(rs, out)
@@ -657,20 +769,24 @@ func (h *hAPI) RoutesViewAction(c *gin.Context) {
 	}
 
 	var out outRoute
-	q := qb.Select("id", "uuid", "path", "methods", "adapter", "octet_length(script)", "timeout", "hint", "is_enabled").From("routes").Where("id = ?", id)
-	if err := q.Scan(&out.Id, &out.Uuid, &out.Path, &out.Methods, &out.Adapter, &out.ScriptSize, &out.Timeout, &out.Hint, &out.IsEnabled); err != nil {
+	q := qb.Select("id", "uuid", "path", "methods", "conditions", "faults", "adapter", "octet_length(script)", "timeout", "bandwidth", "ttfb", "hint", "is_enabled").From("routes").Where("id = ?", id)
+	if err := q.Scan(&out.Id, &out.Uuid, &out.Path, &out.Methods, &out.Conditions, &out.Faults, &out.Adapter, &out.ScriptSize, &out.Timeout, &out.Bandwidth, &out.TTFB, &out.Hint, &out.IsEnabled); err != nil {
 		panic(err)
 	}
 	h.ok(c, out)
 }
 
 type inRoute struct {
-	id        int
-	Path      string   `form:"path" json:"path" binding:"required,trim,max=255,prefix=/"`
-	Methods   []string `form:"methods" json:"methods" binding:"required,min=1,dive,required,trim,max=16"`
-	Timeout   int      `form:"timeout" json:"timeout" binding:"omitempty,min=0,max=86400"`
-	Hint      *string  `form:"hint" json:"hint" binding:"omitempty,required,trim,max=255"`
-	IsEnabled bool     `form:"is_enabled" json:"is_enabled" binding:"omitempty"`
+	id         int
+	Path       string               `form:"path" json:"path" binding:"required,trim,max=255,prefix=/,path"`
+	Methods    []string             `form:"methods" json:"methods" binding:"required,min=1,dive,required,trim,max=16"`
+	Conditions yams.RouteConditions `form:"-" json:"conditions" binding:"omitempty,max=32,dive,condition"`
+	Faults     yams.Faults          `form:"-" json:"faults" binding:"omitempty,max=16,dive"`
+	Bandwidth  *int                 `form:"bandwidth" json:"bandwidth" binding:"omitempty,min=1,max=2147483647"`
+	TTFB       *int                 `form:"ttfb" json:"ttfb" binding:"omitempty,min=0,max=3600000"`
+	Timeout    int                  `form:"timeout" json:"timeout" binding:"omitempty,min=0,max=86400"`
+	Hint       *string              `form:"hint" json:"hint" binding:"omitempty,required,trim,max=255"`
+	IsEnabled  bool                 `form:"is_enabled" json:"is_enabled" binding:"omitempty"`
 }
 
 func (h *hAPI) RoutesCreateAction(c *gin.Context) {
@@ -689,6 +805,10 @@ func (h *hAPI) RoutesCreateAction(c *gin.Context) {
 		"profile_id": pid,
 		"path":       in.Path,
 		"methods":    pq.StringArray(in.Methods),
+		"conditions": in.Conditions,
+		"faults":     in.Faults,
+		"bandwidth":  in.Bandwidth,
+		"ttfb":       in.TTFB,
 		"script":     yams.DefaultScript,
 		"timeout":    in.Timeout,
 		"hint":       in.Hint,
@@ -714,6 +834,10 @@ func (h *hAPI) RoutesUpdateAction(c *gin.Context) {
 	q := qb.Update("routes").SetMap(gin.H{
 		"path":       in.Path,
 		"methods":    pq.StringArray(in.Methods),
+		"conditions": in.Conditions,
+		"faults":     in.Faults,
+		"bandwidth":  in.Bandwidth,
+		"ttfb":       in.TTFB,
 		"timeout":    in.Timeout,
 		"hint":       in.Hint,
 		"is_enabled": in.IsEnabled,
@@ -767,6 +891,13 @@ func (h *hAPI) RoutesScriptUpdateAction(c *gin.Context) {
 		panic(err)
 	}
 
+	if adapter == yams.AdapterStatic {
+		if _, err = yams.ParseStatic(buf); err != nil {
+			h.badRequest(c, errCodeInvalidDocument, err)
+			return
+		}
+	}
+
 	q := qb.Update("routes").SetMap(gin.H{
 		"adapter": adapter,
 		"script":  buf,
@@ -777,6 +908,56 @@ func (h *hAPI) RoutesScriptUpdateAction(c *gin.Context) {
 	h.ok(c, nil)
 }
 
+func (h *hAPI) RoutesConvertAction(c *gin.Context) {
+	id := h.paramInt(c, "id")
+	if !h.checkRouteAccess(c, id) {
+		return
+	}
+
+	var in struct {
+		Adapter string `form:"adapter" json:"adapter" binding:"required,oneof=lua static"`
+	}
+	if !h.bind(c, &in) {
+		return
+	}
+
+	var adapter string
+	var script []byte
+	q := qb.Select("adapter", "script").From("routes").Where("id = ?", id)
+	if err := q.Scan(&adapter, &script); err != nil {
+		panic(err)
+	}
+
+	var err error
+	switch {
+	case adapter == in.Adapter:
+		h.ok(c, nil)
+		return
+	case adapter == yams.AdapterStatic && in.Adapter == yams.AdapterLua:
+		var out string
+		if out, err = staticToLua(script); err == nil {
+			script = []byte(out)
+		}
+	case adapter == yams.AdapterLua && in.Adapter == yams.AdapterStatic:
+		script, err = luaToStatic(string(script))
+	default:
+		err = fmt.Errorf(`"%s" adapter cannot be converted`, adapter)
+	}
+	if err != nil {
+		h.badRequest(c, errCodeUnconvertibleScript, err)
+		return
+	}
+
+	uq := qb.Update("routes").SetMap(gin.H{
+		"adapter": in.Adapter,
+		"script":  script,
+	}).Where("id = ?", id)
+	if _, err = uq.Exec(); err != nil {
+		panic(err)
+	}
+	h.ok(c, nil)
+}
+
 func (h *hAPI) RoutesPositionAction(c *gin.Context) {
 	id := h.paramInt(c, "id")
 	if !h.checkRouteAccess(c, id) {
@@ -945,3 +1126,445 @@ func (h *hAPI) AssetsDeleteAction(c *gin.Context) {
 	}
 	h.ok(c, nil)
 }
+
+type outJournal struct {
+	Id            int64     `json:"id"`
+	RouteUuid     *string   `json:"route_uuid"`
+	Sid           *string   `json:"sid"`
+	Method        string    `json:"method"`
+	Host          string    `json:"host"`
+	Uri           string    `json:"uri"`
+	Ip            string    `json:"ip"`
+	Status        int       `json:"status"`
+	IsIntercepted bool      `json:"is_intercepted"`
+	Backend       *string   `json:"backend"`
+	Duration      float64   `json:"duration"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type outJournalEntry struct {
+	outJournal
+	ReqHeaders json.RawMessage `json:"req_headers"`
+	ReqBody    []byte          `json:"req_body"`
+	ResHeaders json.RawMessage `json:"res_headers"`
+	ResBody    []byte          `json:"res_body"`
+}
+
+type inJournalFilter struct {
+	Method        string    `form:"method" binding:"omitempty,trim,max=16"`
+	Uri           string    `form:"uri" binding:"omitempty,max=4096"`
+	Status        int       `form:"status" binding:"omitempty,min=100,max=599"`
+	RouteUuid     string    `form:"route_uuid" binding:"omitempty,uuid"`
+	Sid           string    `form:"sid" binding:"omitempty,max=24"`
+	IsIntercepted string    `form:"is_intercepted" binding:"omitempty,oneof=true false"`
+	Since         time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+	Until         time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty"`
+}
+
+func (in inJournalFilter) where(pid int) sqrl.And {
+	where := sqrl.And{sqrl.Eq{"profile_id": pid}}
+	if in.Method != "" {
+		where = append(where, sqrl.Eq{"method": strings.ToUpper(in.Method)})
+	}
+	if in.Uri != "" {
+		where = append(where, sqrl.Expr("strpos(uri, ?) = 1", in.Uri))
+	}
+	if in.Status != 0 {
+		where = append(where, sqrl.Eq{"status": in.Status})
+	}
+	if in.RouteUuid != "" {
+		where = append(where, sqrl.Eq{"route_uuid": in.RouteUuid})
+	}
+	if in.Sid != "" {
+		where = append(where, sqrl.Eq{"sid": in.Sid})
+	}
+	if in.IsIntercepted != "" {
+		where = append(where, sqrl.Eq{"is_intercepted": in.IsIntercepted == "true"})
+	}
+	if !in.Since.IsZero() {
+		where = append(where, sqrl.Expr("created_at >= ?", in.Since))
+	}
+	if !in.Until.IsZero() {
+		where = append(where, sqrl.Expr("created_at < ?", in.Until))
+	}
+	return where
+}
+
+func (h *hAPI) JournalAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	var in struct {
+		inJournalFilter
+		Limit  uint64 `form:"limit" binding:"omitempty,min=1,max=1000"`
+		Offset uint64 `form:"offset" binding:"omitempty"`
+	}
+	if !h.bind(c, &in) {
+		return
+	}
+	if in.Limit == 0 {
+		in.Limit = 100
+	}
+
+	q := qb.Select("id", "route_uuid", "sid", "method", "host", "uri", "ip", "status", "is_intercepted", "backend", "duration", "created_at").
+		From("journal").Where(in.where(pid)).OrderBy("id DESC").Limit(in.Limit).Offset(in.Offset)
+	rows, err := q.Query()
+	defer rows.Close()
+
+	rs := make([]outJournal, 0)
+	for rows.Next() {
+		var out outJournal
+		if err = rows.Scan(&out.Id, &out.RouteUuid, &out.Sid, &out.Method, &out.Host, &out.Uri, &out.Ip, &out.Status, &out.IsIntercepted, &out.Backend, &out.Duration, &out.CreatedAt); err != nil {
+			panic(err)
+		}
+		rs = append(rs, out)
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+	h.ok(c, rs)
+}
+
+func (h *hAPI) JournalViewAction(c *gin.Context) {
+	id := h.paramInt(c, "id")
+	if !h.checkJournalAccess(c, id) {
+		return
+	}
+
+	var out outJournalEntry
+	var reqHeaders, resHeaders []byte
+	q := qb.Select("id", "route_uuid", "sid", "method", "host", "uri", "ip", "status", "is_intercepted", "backend", "duration", "created_at", "req_headers", "req_body", "res_headers", "res_body").
+		From("journal").Where("id = ?", id)
+	if err := q.Scan(&out.Id, &out.RouteUuid, &out.Sid, &out.Method, &out.Host, &out.Uri, &out.Ip, &out.Status, &out.IsIntercepted, &out.Backend, &out.Duration, &out.CreatedAt, &reqHeaders, &out.ReqBody, &resHeaders, &out.ResBody); err != nil {
+		panic(err)
+	}
+	out.ReqHeaders, out.ResHeaders = reqHeaders, resHeaders
+	h.ok(c, out)
+}
+
+func (h *hAPI) JournalPurgeAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	var in inJournalFilter
+	if !h.bind(c, &in) {
+		return
+	}
+
+	q := qb.Delete("journal").Where(in.where(pid))
+	if _, err := q.Exec(); err != nil {
+		panic(err)
+	}
+	h.ok(c, nil)
+}
+
+type outRecording struct {
+	Id        int64     `json:"id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query"`
+	Status    int       `json:"status"`
+	MimeType  *string   `json:"mime_type"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *hAPI) RecordingsAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	var in struct {
+		Limit  uint64 `form:"limit" binding:"omitempty,min=1,max=1000"`
+		Offset uint64 `form:"offset" binding:"omitempty"`
+	}
+	if !h.bind(c, &in) {
+		return
+	}
+	if in.Limit == 0 {
+		in.Limit = 100
+	}
+
+	q := qb.Select("id", "method", "path", "query", "status", "headers->'Content-Type'->>0", "octet_length(body)", "created_at").
+		From("recordings").Where("profile_id = ?", pid).OrderBy("id DESC").Limit(in.Limit).Offset(in.Offset)
+	rows, err := q.Query()
+	defer rows.Close()
+
+	rs := make([]outRecording, 0)
+	for rows.Next() {
+		var out outRecording
+		if err = rows.Scan(&out.Id, &out.Method, &out.Path, &out.Query, &out.Status, &out.MimeType, &out.Size, &out.CreatedAt); err != nil {
+			panic(err)
+		}
+		rs = append(rs, out)
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+	h.ok(c, rs)
+}
+
+func (h *hAPI) RecordingsConvertAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	var in struct {
+		Ids   []int64 `form:"ids" json:"ids" binding:"omitempty,dive,min=1"`
+		Purge bool    `form:"purge" json:"purge" binding:"omitempty"`
+	}
+	if !h.bind(c, &in) {
+		return
+	}
+
+	// the latest recording wins for the same request
+	q := qb.Select("DISTINCT ON (method, path) method", "path", "query", "status", "headers", "body").
+		From("recordings").Where("profile_id = ?", pid).OrderBy("method", "path", "id DESC")
+	if len(in.Ids) > 0 {
+		q.Where(sqrl.Eq{"id": in.Ids})
+	}
+	rows, err := q.Query()
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var ms []mockResponse
+	for rows.Next() {
+		var m mockResponse
+		var query string
+		var header []byte
+		if err = rows.Scan(&m.Method, &m.Path, &query, &m.Status, &header, &m.Body); err != nil {
+			panic(err)
+		}
+		if err = json.Unmarshal(header, &m.Header); err != nil {
+			panic(err)
+		}
+		m.Hint = "Recorded " + m.Method + " " + m.Path
+		if query != "" {
+			m.Hint += "?" + query
+		}
+		m.Hint = truncateHint(m.Hint)
+		ms = append(ms, m)
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	ids, skipped := createMockRoutes(tx, pid, ms)
+	if in.Purge {
+		q := qb.Delete("recordings").Where("profile_id = ?", pid)
+		if len(in.Ids) > 0 {
+			q.Where(sqrl.Eq{"id": in.Ids})
+		}
+		if _, err = q.RunWith(tx).Exec(); err != nil {
+			panic(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		panic(err)
+	}
+	h.ok(c, gin.H{"ids": ids, "skipped": skipped})
+}
+
+func (h *hAPI) RecordingsPurgeAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	q := qb.Delete("recordings").Where("profile_id = ?", pid)
+	if _, err := q.Exec(); err != nil {
+		panic(err)
+	}
+	h.ok(c, nil)
+}
+
+func (h *hAPI) ImportHARAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	if c.Request.ContentLength > yams.MaxAssetSize {
+		h.requestEntityTooLarge(c, errCodeUnknown, nil)
+		return
+	}
+
+	dedupe, _ := strconv.ParseBool(c.Query("dedupe"))
+	parameterize, _ := strconv.ParseBool(c.Query("parameterize"))
+	ms, err := parseHAR(io.LimitReader(c.Request.Body, yams.MaxAssetSize), dedupe, parameterize)
+	if err != nil {
+		h.badRequest(c, errCodeInvalidDocument, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	ids, skipped := createMockRoutes(tx, pid, ms)
+	if err = tx.Commit(); err != nil {
+		panic(err)
+	}
+	h.ok(c, gin.H{"ids": ids, "skipped": skipped})
+}
+
+func (h *hAPI) SpecAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	var spec []byte
+	q := qb.Select("spec").From("profiles").Where("id = ?", pid)
+	if err := q.Scan(&spec); err != nil {
+		panic(err)
+	}
+	if spec == nil {
+		h.notFound(c, errCodeUnknown, nil)
+		return
+	}
+	c.Data(http.StatusOK, gin.MIMEJSON, spec)
+}
+
+func (h *hAPI) SpecUploadAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	if c.Request.ContentLength > yams.MaxScriptSize {
+		h.requestEntityTooLarge(c, errCodeUnknown, nil)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, yams.MaxScriptSize))
+	if err != nil {
+		panic(err)
+	}
+	if data, err = openapi.ToJSON(data); err != nil {
+		h.badRequest(c, errCodeInvalidDocument, err)
+		return
+	}
+	d, err := openapi.Load(data)
+	if err != nil {
+		h.badRequest(c, errCodeInvalidDocument, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	q := qb.Update("profiles").Set("spec", data).Where("id = ?", pid)
+	if _, err = q.RunWith(tx).Exec(); err != nil {
+		panic(err)
+	}
+
+	out := syncSpecRoutes(tx, pid, d)
+	if err = tx.Commit(); err != nil {
+		panic(err)
+	}
+	h.ok(c, out)
+}
+
+func (h *hAPI) SpecSyncAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	var spec []byte
+	q := qb.Select("spec").From("profiles").Where("id = ?", pid).Suffix("FOR UPDATE")
+	if err = q.RunWith(tx).Scan(&spec); err != nil {
+		panic(err)
+	}
+	if spec == nil {
+		h.notFound(c, errCodeUnknown, nil)
+		return
+	}
+
+	d, err := openapi.Load(spec)
+	if err != nil {
+		panic(err)
+	}
+
+	out := syncSpecRoutes(tx, pid, d)
+	if err = tx.Commit(); err != nil {
+		panic(err)
+	}
+	h.ok(c, out)
+}
+
+func (h *hAPI) SpecDeleteAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	q := qb.Update("profiles").Set("spec", nil).Where("id = ?", pid)
+	if _, err = q.RunWith(tx).Exec(); err != nil {
+		panic(err)
+	}
+
+	// generated routes are kept as regular ones
+	q = qb.Update("routes").SetMap(gin.H{"spec_operation": nil, "spec_hash": nil}).
+		Where("profile_id = ? AND spec_operation IS NOT NULL", pid)
+	if _, err = q.RunWith(tx).Exec(); err != nil {
+		panic(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		panic(err)
+	}
+	h.ok(c, nil)
+}
+
+func (h *hAPI) ExportOpenAPIAction(c *gin.Context) {
+	pid := h.paramInt(c, "id")
+	if !h.checkProfileAccess(c, pid) {
+		return
+	}
+
+	d := exportSpec(pid)
+	if c.Query("format") != "yaml" {
+		h.ok(c, d)
+		return
+	}
+
+	data, err := openapi.ToYAML(d)
+	if err != nil {
+		panic(err)
+	}
+	c.Data(http.StatusOK, "application/x-yaml", data)
+}
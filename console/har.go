@@ -0,0 +1,133 @@
+package console
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lokhman/yams/yams"
+)
+
+// HTTP Archive format, see http://www.softwareishard.com/blog/har-12-spec/.
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int         `json:"status"`
+		Headers []harHeader `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Headers which do not apply to decoded content of HAR entries.
+var harSkipHeaders = []string{
+	"Content-Encoding",
+	"Content-Length",
+}
+
+// Parses HAR archive into mock responses. Identical requests are replaced by
+// the latest entry if dedupe is set, and numeric path segments are replaced
+// with parameters if parameterize is set.
+func parseHAR(r io.Reader, dedupe, parameterize bool) ([]mockResponse, error) {
+	var archive har
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, err
+	}
+	if archive.Log.Entries == nil {
+		return nil, errors.New("har: no entries found")
+	}
+
+	var ms []mockResponse
+	index := make(map[string]int)
+	for _, e := range archive.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || e.Request.Method == "" || e.Response.Status == 0 {
+			continue
+		}
+
+		m := mockResponse{
+			Method: strings.ToUpper(e.Request.Method),
+			Path:   u.Path,
+			Status: e.Response.Status,
+			Header: make(http.Header),
+			Hint:   "Imported " + strings.ToUpper(e.Request.Method) + " " + u.RequestURI(),
+		}
+		if m.Path == "" {
+			m.Path = "/"
+		}
+		if parameterize {
+			m.Path = harParameterize(m.Path)
+		}
+		m.Hint = truncateHint(m.Hint)
+
+		for _, h := range e.Response.Headers {
+			// skip HTTP/2 pseudo headers
+			if strings.HasPrefix(h.Name, ":") || yams.InStringSlice(harSkipHeaders, http.CanonicalHeaderKey(h.Name)) {
+				continue
+			}
+			m.Header.Add(h.Name, h.Value)
+		}
+		if m.Header.Get("Content-Type") == "" && e.Response.Content.MimeType != "" {
+			m.Header.Set("Content-Type", e.Response.Content.MimeType)
+		}
+
+		if e.Response.Content.Encoding == "base64" {
+			if m.Body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				continue
+			}
+		} else {
+			m.Body = []byte(e.Response.Content.Text)
+		}
+
+		key := m.Method + " " + m.Path
+		if i, ok := index[key]; ok && dedupe {
+			ms[i] = m
+			continue
+		}
+		index[key] = len(ms)
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Replaces numeric path segments with "{id:int}" parameters.
+func harParameterize(path string) string {
+	n := 0
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(segment, 10, 64); err != nil {
+			continue
+		}
+		if n++; n == 1 {
+			segments[i] = "{id:" + yams.PathTypeInt + "}"
+		} else {
+			segments[i] = "{id" + strconv.Itoa(n) + ":" + yams.PathTypeInt + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
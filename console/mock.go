@@ -0,0 +1,167 @@
+package console
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/lokhman/yams/yams"
+)
+
+// Responses with larger or binary bodies are stored as profile assets.
+const mockInlineBodySize = 16 << 10 // 16KB
+
+var mockSkipHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Date",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// mockResponse is the observed response, which is converted to the route with
+// generated Lua script that reproduces it.
+type mockResponse struct {
+	Method string
+	Path   string
+	Status int
+	Header http.Header
+	Body   []byte
+	Hint   string
+}
+
+// Truncates route hint to 255 characters, as limited by the database.
+func truncateHint(hint string) string {
+	n := 0
+	for i := range hint {
+		if n == 255 {
+			return hint[:i]
+		}
+		n++
+	}
+	return hint
+}
+
+func (m mockResponse) mimeType() string {
+	if mimeType := m.Header.Get("Content-Type"); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+func (m mockResponse) script(asset string) string {
+	buf := bytes.NewBufferString("local yams = require(\"yams\")\n\n")
+	fmt.Fprintf(buf, "yams.setstatus(%d)\n", m.Status)
+
+	keys := make([]string, 0, len(m.Header))
+	for k := range m.Header {
+		if !yams.InStringSlice(mockSkipHeaders, http.CanonicalHeaderKey(k)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if vv := m.Header[k]; len(vv) > 0 {
+			fmt.Fprintf(buf, "yams.setheader(%s", luaQuote(k))
+			for _, v := range vv {
+				fmt.Fprintf(buf, ", %s", luaQuote(v))
+			}
+			buf.WriteString(")\n")
+		}
+	}
+
+	if asset != "" {
+		fmt.Fprintf(buf, "yams.write(yams.asset(%s))\n", luaQuote(asset))
+	} else if len(m.Body) > 0 {
+		fmt.Fprintf(buf, "yams.write(%s)\n", luaQuote(string(m.Body)))
+	}
+	return buf.String()
+}
+
+// Stores larger or binary body as profile asset and returns the script.
+func (m mockResponse) save(tx *sql.Tx, pid int) string {
+	var asset string
+	if len(m.Body) > mockInlineBodySize || yams.IsBinaryString(string(m.Body)) {
+		sum := sha1.Sum(m.Body)
+		asset = "mocks/" + hex.EncodeToString(sum[:])
+		q := qb.Insert("assets").SetMap(gin.H{
+			"profile_id": pid,
+			"path":       asset,
+			"data":       m.Body,
+			"mime_type":  m.mimeType(),
+		}).Suffix("ON CONFLICT (profile_id, path) DO UPDATE SET mime_type = EXCLUDED.mime_type")
+		if _, err := q.RunWith(tx).Exec(); err != nil {
+			panic(err)
+		}
+	}
+	return m.script(asset)
+}
+
+// Creates routes with assets for mock responses and returns their ids, and
+// responses skipped for paths that cannot be routed.
+func createMockRoutes(tx *sql.Tx, pid int, ms []mockResponse) ([]int, []string) {
+	ids := make([]int, 0, len(ms))
+	skipped := make([]string, 0)
+	for _, m := range ms {
+		if _, err := yams.ParsePath(m.Path); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s %s: %v", m.Method, m.Path, err))
+			continue
+		}
+
+		var hint *string
+		if m.Hint != "" {
+			hint = &m.Hint
+		}
+
+		var id int
+		q := qb.Insert("routes").SetMap(gin.H{
+			"profile_id": pid,
+			"path":       m.Path,
+			"methods":    pq.StringArray{m.Method},
+			"adapter":    yams.AdapterLua,
+			"script":     []byte(m.save(tx, pid)),
+			"hint":       hint,
+		}).Suffix("RETURNING id")
+		if err := q.RunWith(tx).Scan(&id); err != nil {
+			panic(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, skipped
+}
+
+// Quotes string as Lua 5.1 literal, which is safe for any bytes.
+func luaQuote(s string) string {
+	buf := bytes.NewBufferString(`"`)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(buf, `\%03d`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
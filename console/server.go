@@ -38,6 +38,7 @@ func handler() http.Handler {
 	api := &hAPI{r.Group("/api")}
 	api.GET("", api.IndexAction)
 	api.POST("/auth", api.AuthAction)
+	api.GET("/ca.crt", api.CACertificateAction)
 
 	// API private
 	api = &hAPI{r.Group("/api")}
@@ -64,6 +65,7 @@ func handler() http.Handler {
 	api.DELETE("/routes/:id", api.Auth(yams.AnyRole...), api.RoutesDeleteAction)
 	api.GET("/routes/:id/script", api.Auth(yams.AnyRole...), api.RoutesScriptViewAction)
 	api.PUT("/routes/:id/script", api.Auth(yams.AnyRole...), api.RoutesScriptUpdateAction)
+	api.POST("/routes/:id/convert", api.Auth(yams.AnyRole...), api.RoutesConvertAction)
 	api.POST("/routes/:id/position", api.Auth(yams.AnyRole...), api.RoutesPositionAction)
 	api.POST("/routes/:id/state", api.Auth(yams.AnyRole...), api.RoutesStateAction)
 
@@ -73,6 +75,22 @@ func handler() http.Handler {
 	api.GET("/profiles/:id/assets/*path", api.Auth(yams.AnyRole...), api.AssetsDownloadAction)
 	api.DELETE("/profiles/:id/assets/*path", api.Auth(yams.AnyRole...), api.AssetsDeleteAction)
 
+	api.GET("/profiles/:id/journal", api.Auth(yams.AnyRole...), api.JournalAction)
+	api.DELETE("/profiles/:id/journal", api.Auth(yams.AnyRole...), api.JournalPurgeAction)
+	api.GET("/journal/:id", api.Auth(yams.AnyRole...), api.JournalViewAction)
+
+	api.GET("/profiles/:id/recordings", api.Auth(yams.AnyRole...), api.RecordingsAction)
+	api.POST("/profiles/:id/recordings/routes", api.Auth(yams.AnyRole...), api.RecordingsConvertAction)
+	api.DELETE("/profiles/:id/recordings", api.Auth(yams.AnyRole...), api.RecordingsPurgeAction)
+
+	api.POST("/profiles/:id/import/har", api.Auth(yams.AnyRole...), api.ImportHARAction)
+	api.GET("/profiles/:id/export/openapi", api.Auth(yams.AnyRole...), api.ExportOpenAPIAction)
+
+	api.GET("/profiles/:id/spec", api.Auth(yams.AnyRole...), api.SpecAction)
+	api.PUT("/profiles/:id/spec", api.Auth(yams.AnyRole...), api.SpecUploadAction)
+	api.POST("/profiles/:id/spec/sync", api.Auth(yams.AnyRole...), api.SpecSyncAction)
+	api.DELETE("/profiles/:id/spec", api.Auth(yams.AnyRole...), api.SpecDeleteAction)
+
 	return r
 }
 
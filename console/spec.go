@@ -0,0 +1,391 @@
+package console
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/lokhman/yams/openapi"
+	"github.com/lokhman/yams/yams"
+)
+
+var (
+	specPathParam     = regexp.MustCompile(`{([^}]*)}`)
+	specPathParamName = regexp.MustCompile(`\W`)
+)
+
+// specRoute is the mock response generated for the OpenAPI operation.
+type specRoute struct {
+	mockResponse
+	Operation string
+}
+
+// Generates mock responses for all operations of OpenAPI document. Operation
+// key, e.g. "GET /users/{id}", identifies the route on subsequent syncs.
+func specRoutes(d *openapi.Document) []specRoute {
+	var rs []specRoute
+	basePath := d.ServerPath()
+	for _, path := range d.SortedPaths() {
+		pi := d.Paths[path]
+		if pi == nil {
+			continue
+		}
+		for _, method := range openapi.Methods {
+			op := pi.Operation(method)
+			if op == nil {
+				continue
+			}
+
+			r := specRoute{Operation: method + " " + path}
+			r.Method, r.Path = method, basePath+specPath(path)
+
+			switch {
+			case op.Summary != "":
+				r.Hint = op.Summary
+			case op.OperationId != "":
+				r.Hint = op.OperationId
+			default:
+				r.Hint = r.Operation
+			}
+			r.Hint = truncateHint(r.Hint)
+
+			var res *openapi.Response
+			var mediaType string
+			r.Status, res, mediaType = d.Example(op)
+			r.Header = make(http.Header)
+			if res != nil {
+				for name, h := range res.Headers {
+					if v := d.Sample(h.Schema); v != nil {
+						r.Header.Set(name, fmt.Sprint(v))
+					}
+				}
+			}
+			if mediaType != "" {
+				r.Header.Set("Content-Type", mediaType)
+				r.Body = specBody(d.MediaExample(res.Content[mediaType]), mediaType)
+			}
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// Converts OpenAPI path template to route path. Parameter names, which are
+// not valid identifiers, are sanitized.
+func specPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return specPathParam.ReplaceAllStringFunc(path, func(param string) string {
+		name := specPathParamName.ReplaceAllString(param[1:len(param)-1], "_")
+		if name == "" || name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		return "{" + name + "}"
+	})
+}
+
+func specBody(v interface{}, mediaType string) []byte {
+	if s, ok := v.(string); ok && !openapi.IsJSON(mediaType) {
+		return []byte(s)
+	}
+	if v == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func specHash(script []byte) string {
+	sum := sha1.Sum(script)
+	return hex.EncodeToString(sum[:])
+}
+
+// Synchronises profile routes with OpenAPI document. Routes are created for
+// new operations and updated for existing ones, but scripts are regenerated
+// only if they were not changed since the previous sync. Routes of removed
+// operations are deleted, unless their scripts were changed, in which case
+// they are detached from the document.
+func syncSpecRoutes(tx *sql.Tx, pid int, d *openapi.Document) gin.H {
+	type route struct {
+		id       int
+		pristine bool
+	}
+
+	q := qb.Select("id", "spec_operation", "spec_hash", "script").From("routes").
+		Where("profile_id = ? AND spec_operation IS NOT NULL", pid)
+	rows, err := q.RunWith(tx).Query()
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	routes := make(map[string]route)
+	for rows.Next() {
+		var r route
+		var operation string
+		var hash sql.NullString
+		var script []byte
+		if err = rows.Scan(&r.id, &operation, &hash, &script); err != nil {
+			panic(err)
+		}
+		r.pristine = hash.Valid && hash.String == specHash(script)
+		routes[operation] = r
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+
+	created, updated, deleted := make([]int, 0), make([]int, 0), make([]int, 0)
+	skipped := make([]string, 0)
+	for _, sr := range specRoutes(d) {
+		if len([]rune(sr.Operation)) > 255 {
+			skipped = append(skipped, sr.Operation+": operation is longer than 255 characters")
+			continue
+		}
+		if _, err := yams.ParsePath(sr.Path); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", sr.Operation, err))
+			continue
+		}
+
+		values := gin.H{
+			"path":    sr.Path,
+			"methods": pq.StringArray{sr.Method},
+			"hint":    sr.Hint,
+		}
+
+		r, ok := routes[sr.Operation]
+		if !ok || r.pristine {
+			script := []byte(sr.save(tx, pid))
+			values["script"] = script
+			values["spec_hash"] = specHash(script)
+		}
+
+		if ok {
+			delete(routes, sr.Operation)
+			q := qb.Update("routes").SetMap(values).Where("id = ?", r.id)
+			if _, err = q.RunWith(tx).Exec(); err != nil {
+				panic(err)
+			}
+			updated = append(updated, r.id)
+			continue
+		}
+
+		var id int
+		values["profile_id"] = pid
+		values["adapter"] = yams.AdapterLua
+		values["spec_operation"] = sr.Operation
+		q := qb.Insert("routes").SetMap(values).Suffix("RETURNING id")
+		if err = q.RunWith(tx).Scan(&id); err != nil {
+			panic(err)
+		}
+		created = append(created, id)
+	}
+
+	for _, r := range routes {
+		if r.pristine {
+			q := qb.Delete("routes").Where("id = ?", r.id)
+			if _, err = q.RunWith(tx).Exec(); err != nil {
+				panic(err)
+			}
+			deleted = append(deleted, r.id)
+		} else {
+			q := qb.Update("routes").SetMap(gin.H{"spec_operation": nil, "spec_hash": nil}).Where("id = ?", r.id)
+			if _, err = q.RunWith(tx).Exec(); err != nil {
+				panic(err)
+			}
+		}
+	}
+	sort.Ints(deleted)
+	return gin.H{"created": created, "updated": updated, "deleted": deleted, "skipped": skipped}
+}
+
+// Methods documented for routes that match any method.
+var specAnyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// Builds OpenAPI document from enabled profile routes. Responses are
+// documented with the latest intercepted journal entries of the routes.
+func exportSpec(pid int) *openapi.Document {
+	var name string
+	var hosts pq.StringArray
+	q := qb.Select("name", "hosts").From("profiles").Where("id = ?", pid)
+	if err := q.Scan(&name, &hosts); err != nil {
+		panic(err)
+	}
+
+	d := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info:    openapi.Info{Title: name, Version: "1.0.0"},
+		Paths:   make(map[string]*openapi.PathItem),
+	}
+	for _, host := range hosts {
+		if hp, err := yams.ParseHost(host); err == nil && !hp.IsPattern() {
+			d.Servers = append(d.Servers, openapi.Server{URL: "http://" + host})
+		}
+	}
+
+	samples := exportSpecSamples(pid)
+
+	q = qb.Select("uuid", "path", "methods", "conditions", "hint").From("routes").
+		Where("profile_id = ? AND is_enabled", pid).OrderBy("position")
+	rows, err := q.Query()
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uuid, path string
+		var methods pq.StringArray
+		var conditions yams.RouteConditions
+		var hint *string
+		if err = rows.Scan(&uuid, &path, &methods, &conditions, &hint); err != nil {
+			panic(err)
+		}
+
+		pp, err := yams.ParsePath(path)
+		if err != nil {
+			continue
+		}
+		pi, ok := d.Paths[pp.Template]
+		if !ok {
+			pi = &openapi.PathItem{}
+			d.Paths[pp.Template] = pi
+		}
+		if yams.InStringSlice(methods, "*") {
+			methods = specAnyMethods
+		}
+
+		for _, method := range methods {
+			// the first matching route wins
+			if pi.Operation(method) != nil {
+				continue
+			}
+
+			op := &openapi.Operation{Responses: make(map[string]*openapi.Response)}
+			if hint != nil {
+				op.Summary = *hint
+			}
+			for _, arg := range pp.Args {
+				op.Parameters = append(op.Parameters, &openapi.Parameter{
+					Name:     arg.Name,
+					In:       "path",
+					Required: true,
+					Schema:   specPathArgSchema(arg),
+				})
+			}
+			for _, rc := range conditions {
+				in := ""
+				switch rc.Source {
+				case yams.ConditionSourceHeader:
+					in = "header"
+				case yams.ConditionSourceQuery:
+					in = "query"
+				default:
+					continue
+				}
+				p := &openapi.Parameter{Name: rc.Name, In: in, Required: true, Schema: &openapi.Schema{Type: "string"}}
+				switch rc.Operator {
+				case yams.ConditionOperatorEquals:
+					p.Schema.Enum = []interface{}{rc.Value}
+				case yams.ConditionOperatorRegex:
+					p.Schema.Pattern = rc.Value
+				}
+				op.Parameters = append(op.Parameters, p)
+			}
+
+			if s, ok := samples[uuid+" "+method]; ok {
+				op.Responses[strconv.Itoa(s.status)] = s.response()
+			} else {
+				op.Responses["default"] = &openapi.Response{Description: "Mock response"}
+			}
+			pi.SetOperation(method, op)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func specPathArgSchema(arg yams.PathArg) *openapi.Schema {
+	switch arg.Type {
+	case yams.PathTypeInt:
+		return &openapi.Schema{Type: "integer"}
+	case yams.PathTypeFloat:
+		return &openapi.Schema{Type: "number"}
+	case "uuid":
+		return &openapi.Schema{Type: "string", Format: "uuid"}
+	case yams.PathTypeString, yams.PathTypeCatchAll:
+		return &openapi.Schema{Type: "string"}
+	}
+	return &openapi.Schema{Type: "string", Pattern: "^" + arg.Pattern + "$"}
+}
+
+type specSample struct {
+	status   int
+	mimeType *string
+	body     []byte
+}
+
+func (s specSample) response() *openapi.Response {
+	r := &openapi.Response{Description: http.StatusText(s.status)}
+	if r.Description == "" {
+		r.Description = "Mock response"
+	}
+	if s.mimeType == nil || len(s.body) == 0 {
+		return r
+	}
+
+	mt := &openapi.MediaType{}
+	if openapi.IsJSON(*s.mimeType) {
+		var v interface{}
+		if json.Unmarshal(s.body, &v) != nil {
+			return r
+		}
+		mt.Schema, mt.Example = openapi.SchemaOf(v), v
+	} else if !yams.IsBinaryString(string(s.body)) {
+		mt.Schema, mt.Example = &openapi.Schema{Type: "string"}, string(s.body)
+	} else {
+		mt.Schema = &openapi.Schema{Type: "string", Format: "binary"}
+	}
+	r.Content = map[string]*openapi.MediaType{*s.mimeType: mt}
+	return r
+}
+
+// Returns the latest journaled script responses by route UUID and method.
+func exportSpecSamples(pid int) map[string]specSample {
+	q := qb.Select("DISTINCT ON (route_uuid, method) route_uuid", "method", "status", "res_headers->'Content-Type'->>0", "res_body").
+		From("journal").Where("profile_id = ? AND is_intercepted", pid).OrderBy("route_uuid", "method", "id DESC")
+	rows, err := q.Query()
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	samples := make(map[string]specSample)
+	for rows.Next() {
+		var uuid, method string
+		var s specSample
+		if err = rows.Scan(&uuid, &method, &s.status, &s.mimeType, &s.body); err != nil {
+			panic(err)
+		}
+		samples[uuid+" "+method] = s
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+	return samples
+}
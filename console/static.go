@@ -0,0 +1,178 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lokhman/yams-lua/ast"
+	"github.com/lokhman/yams-lua/parse"
+	"github.com/lokhman/yams/yams"
+)
+
+var errUnconvertibleScript = errors.New("script does not only write static response")
+
+// Converts static route document to Lua script, which reproduces it.
+func staticToLua(data []byte) (string, error) {
+	sr, err := yams.ParseStatic(data)
+	if err != nil {
+		return "", err
+	}
+
+	m := mockResponse{Status: sr.Status, Header: http.Header(sr.Headers), Body: []byte(sr.Body)}
+	if m.Status == 0 {
+		m.Status = http.StatusOK
+	}
+	script := m.script(sr.Asset)
+	if sr.Delay > 0 {
+		script += fmt.Sprintf("yams.sleep(%s)\n", strconv.FormatFloat(float64(sr.Delay)/1000, 'f', -1, 64))
+	}
+	return script, nil
+}
+
+// Converts Lua script to static route document, if the script only sets
+// status and headers, writes strings or single asset and sleeps, e.g. the
+// one generated by staticToLua.
+func luaToStatic(script string) ([]byte, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), "<string>")
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &yams.StaticResponse{Headers: make(yams.StaticHeader)}
+	var body strings.Builder
+	for _, stmt := range chunk {
+		switch stmt := stmt.(type) {
+		case *ast.LocalAssignStmt:
+			// local yams = require("yams")
+			if len(stmt.Names) != 1 || stmt.Names[0] != "yams" || len(stmt.Exprs) != 1 {
+				return nil, errUnconvertibleScript
+			}
+			call, ok := stmt.Exprs[0].(*ast.FuncCallExpr)
+			if !ok || luaIdent(call.Func) != "require" || len(call.Args) != 1 {
+				return nil, errUnconvertibleScript
+			}
+			if s, ok := luaString(call.Args[0]); !ok || s != "yams" {
+				return nil, errUnconvertibleScript
+			}
+		case *ast.FuncCallStmt:
+			call, ok := stmt.Expr.(*ast.FuncCallExpr)
+			if !ok {
+				return nil, errUnconvertibleScript
+			}
+			switch luaYamsFunc(call) {
+			case "setstatus":
+				if len(call.Args) != 1 {
+					return nil, errUnconvertibleScript
+				}
+				n, ok := luaNumber(call.Args[0])
+				if !ok {
+					return nil, errUnconvertibleScript
+				}
+				sr.Status = int(n)
+			case "setheader":
+				if len(call.Args) < 2 {
+					return nil, errUnconvertibleScript
+				}
+				vv, ok := luaStrings(call.Args)
+				if !ok {
+					return nil, errUnconvertibleScript
+				}
+				sr.Headers[http.CanonicalHeaderKey(vv[0])] = vv[1:]
+			case "write":
+				if len(call.Args) == 1 {
+					if asset, ok := call.Args[0].(*ast.FuncCallExpr); ok {
+						if luaYamsFunc(asset) != "asset" || len(asset.Args) != 1 || sr.Asset != "" || body.Len() > 0 {
+							return nil, errUnconvertibleScript
+						}
+						if sr.Asset, ok = luaString(asset.Args[0]); !ok {
+							return nil, errUnconvertibleScript
+						}
+						continue
+					}
+				}
+				vv, ok := luaStrings(call.Args)
+				if !ok || sr.Asset != "" {
+					return nil, errUnconvertibleScript
+				}
+				for _, v := range vv {
+					body.WriteString(v)
+				}
+			case "sleep":
+				if len(call.Args) != 1 {
+					return nil, errUnconvertibleScript
+				}
+				n, ok := luaNumber(call.Args[0])
+				if !ok {
+					return nil, errUnconvertibleScript
+				}
+				sr.Delay += int(n * 1000)
+			default:
+				return nil, errUnconvertibleScript
+			}
+		default:
+			return nil, errUnconvertibleScript
+		}
+	}
+	sr.Body = body.String()
+	if len(sr.Headers) == 0 {
+		sr.Headers = nil
+	}
+
+	data, err := json.MarshalIndent(sr, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// document must be valid for the proxy
+	if _, err = yams.ParseStatic(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Returns name of yams module function, which is called, e.g. "write".
+func luaYamsFunc(call *ast.FuncCallExpr) string {
+	attr, ok := call.Func.(*ast.AttrGetExpr)
+	if !ok || call.Receiver != nil || luaIdent(attr.Object) != "yams" {
+		return ""
+	}
+	name, _ := luaString(attr.Key)
+	return name
+}
+
+func luaIdent(expr ast.Expr) string {
+	if ident, ok := expr.(*ast.IdentExpr); ok {
+		return ident.Value
+	}
+	return ""
+}
+
+func luaString(expr ast.Expr) (string, bool) {
+	if s, ok := expr.(*ast.StringExpr); ok {
+		return s.Value, true
+	}
+	return "", false
+}
+
+func luaStrings(exprs []ast.Expr) ([]string, bool) {
+	ss := make([]string, len(exprs))
+	for i, expr := range exprs {
+		var ok bool
+		if ss[i], ok = luaString(expr); !ok {
+			return nil, false
+		}
+	}
+	return ss, true
+}
+
+func luaNumber(expr ast.Expr) (float64, bool) {
+	n, ok := expr.(*ast.NumberExpr)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(n.Value, 64)
+	return f, err == nil
+}
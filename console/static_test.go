@@ -0,0 +1,121 @@
+package console
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lokhman/yams/yams"
+)
+
+func TestStaticToLuaRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want yams.StaticResponse
+	}{
+		{
+			name: "default status",
+			doc:  `{"body": "OK"}`,
+			want: yams.StaticResponse{Status: 200, Body: "OK"},
+		},
+		{
+			name: "headers",
+			doc:  `{"status": 201, "headers": {"content-type": "application/json", "Set-Cookie": ["a=1", "b=2"]}, "body": "{\"id\": 1}"}`,
+			want: yams.StaticResponse{
+				Status:  201,
+				Headers: yams.StaticHeader{"Content-Type": {"application/json"}, "Set-Cookie": {"a=1", "b=2"}},
+				Body:    `{"id": 1}`,
+			},
+		},
+		{
+			name: "escaped body",
+			doc:  `{"body": "line 1\r\nline \"2\"\t\\ \u0001 é"}`,
+			want: yams.StaticResponse{Status: 200, Body: "line 1\r\nline \"2\"\t\\ \x01 é"},
+		},
+		{
+			name: "asset",
+			doc:  `{"status": 404, "asset": "pages/404.html"}`,
+			want: yams.StaticResponse{Status: 404, Asset: "pages/404.html"},
+		},
+		{
+			name: "delay",
+			doc:  `{"status": 204, "delay": 1500}`,
+			want: yams.StaticResponse{Status: 204, Delay: 1500},
+		},
+		{
+			name: "skipped headers",
+			doc:  `{"headers": {"Content-Length": "2", "X-Id": "1"}, "body": "OK"}`,
+			want: yams.StaticResponse{Status: 200, Headers: yams.StaticHeader{"X-Id": {"1"}}, Body: "OK"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := staticToLua([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("staticToLua() error = %v", err)
+			}
+			data, err := luaToStatic(script)
+			if err != nil {
+				t.Fatalf("luaToStatic() error = %v, script:\n%s", err, script)
+			}
+			sr, err := yams.ParseStatic(data)
+			if err != nil {
+				t.Fatalf("ParseStatic() error = %v", err)
+			}
+			if !reflect.DeepEqual(*sr, tt.want) {
+				t.Errorf("luaToStatic() = %+v, want %+v", *sr, tt.want)
+			}
+
+			// converted document produces the same script
+			again, err := staticToLua(data)
+			if err != nil {
+				t.Fatalf("staticToLua() error = %v", err)
+			}
+			if again != script {
+				t.Errorf("staticToLua() = %q, want %q", again, script)
+			}
+		})
+	}
+}
+
+func TestStaticToLuaErrors(t *testing.T) {
+	tests := []string{
+		`{"status": 200`,
+		`{"status": 99}`,
+		`{"unknown": true}`,
+		`{"body": "OK", "asset": "index.html"}`,
+		`{"delay": -1}`,
+	}
+
+	for _, doc := range tests {
+		t.Run(doc, func(t *testing.T) {
+			if _, err := staticToLua([]byte(doc)); err == nil {
+				t.Errorf("staticToLua(%s) error = nil", doc)
+			}
+		})
+	}
+}
+
+func TestLuaToStaticUnconvertible(t *testing.T) {
+	tests := map[string]string{
+		"syntax error":    `yams.write(`,
+		"condition":       "if yams.method == \"GET\" then\n  yams.write(\"OK\")\nend",
+		"variable":        "local body = \"OK\"\nyams.write(body)",
+		"other module":    "local json = require(\"json\")",
+		"other function":  `yams.pass("http://localhost")`,
+		"method call":     `yams:write("OK")`,
+		"write and asset": "yams.write(\"OK\")\nyams.write(yams.asset(\"index.html\"))",
+		"two assets":      "yams.write(yams.asset(\"a.html\"))\nyams.write(yams.asset(\"b.html\"))",
+		"invalid status":  `yams.setstatus(1000)`,
+		"dynamic header":  `yams.setheader("X-Time", os.time())`,
+	}
+
+	for name, script := range tests {
+		t.Run(name, func(t *testing.T) {
+			if data, err := luaToStatic(script); err == nil {
+				t.Errorf("luaToStatic() = %s, want error", data)
+			}
+		})
+	}
+}
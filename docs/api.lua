@@ -25,6 +25,7 @@ yams.write([=[
         <li><a href="#yams.method">yams.method</a></li>
         <li><a href="#yams.scheme">yams.scheme</a></li>
         <li><a href="#yams.host">yams.host</a></li>
+        <li><a href="#yams.hostparams">yams.hostparams</a></li>
         <li><a href="#yams.uri">yams.uri</a></li>
         <li><a href="#yams.ip">yams.ip</a></li>
         <li><a href="#yams.sessionid">yams.sessionid</a></li>
@@ -33,6 +34,7 @@ yams.write([=[
         <li><a href="#yams.headers">yams.headers</a></li>
         <li><a href="#yams.query">yams.query</a></li>
         <li><a href="#yams.cookies">yams.cookies</a></li>
+        <li><a href="#yams.clientcert">yams.clientcert</a></li>
         <li><a href="#yams.setstatus">yams.setstatus(code)</a></li>
         <li><a href="#yams.getheader">yams.getheader(name)</a></li>
         <li><a href="#yams.setheader">yams.setheader(name, value [, value, ...])</a></li>
@@ -42,15 +44,56 @@ yams.write([=[
         <li><a href="#yams.getbody">yams.getbody()</a></li>
         <li><a href="#yams.asset">yams.asset(path)</a></li>
         <li><a href="#yams.sleep">yams.sleep(seconds)</a></li>
+        <li><a href="#yams.setbandwidth">yams.setbandwidth(rate [, ttfb])</a></li>
         <li><a href="#yams.write">yams.write(...)</a></li>
+        <li><a href="#yams.flush">yams.flush()</a></li>
+        <li><a href="#yams.sse">yams.sse(event, data [, id])</a></li>
         <li><a href="#yams.getvar">yams.getvar(name [, islocal])</a></li>
         <li><a href="#yams.setvar">yams.setvar(name [, value [, islocal [, lifetime]]])</a></li>
         <li><a href="#yams.dump">yams.dump([withbody])</a></li>
         <li><a href="#yams.wbclean">yams.wbclean()</a></li>
         <li><a href="#yams.pass">yams.pass([url])</a></li>
+        <li><a href="#yams.fetch">yams.fetch([url])</a></li>
+        <li><a href="#yams.send">yams.send(response)</a></li>
         <li><a href="#yams.exit">yams.exit()</a></li>
       </ul>
     </li>
+    <li>
+      <strong>yams.ws</strong>
+      <ul>
+        <li><a href="#yams.ws.requested">yams.ws.requested</a></li>
+        <li><a href="#yams.ws.upgrade">yams.ws.upgrade([protocol])</a></li>
+        <li><a href="#yams.ws.receive">yams.ws.receive([timeout])</a></li>
+        <li><a href="#yams.ws.send">yams.ws.send(data [, binary])</a></li>
+        <li><a href="#yams.ws.close">yams.ws.close([code [, reason]])</a></li>
+        <li><a href="#yams.ws.settimer">yams.ws.settimer(seconds, callback [, repeat])</a></li>
+        <li><a href="#yams.ws.cleartimer">yams.ws.cleartimer(id)</a></li>
+      </ul>
+    </li>
+    <li>
+      <strong>yams.http</strong>
+      <ul>
+        <li><a href="#yams.http.request">yams.http.request(options)</a></li>
+        <li><a href="#yams.http.get">yams.http.get(url [, headers])</a></li>
+        <li><a href="#yams.http.post">yams.http.post(url, body [, headers])</a></li>
+      </ul>
+    </li>
+    <li>
+      <strong>yams.grpc</strong>
+      <ul>
+        <li><a href="#yams.grpc.service">yams.grpc.service</a></li>
+        <li><a href="#yams.grpc.method">yams.grpc.method</a></li>
+        <li><a href="#yams.grpc.request">yams.grpc.request</a></li>
+        <li><a href="#yams.grpc.requests">yams.grpc.requests</a></li>
+        <li><a href="#yams.grpc.codes">yams.grpc.codes</a></li>
+        <li><a href="#yams.grpc.setstatus">yams.grpc.setstatus(code [, message])</a></li>
+        <li><a href="#yams.grpc.settrailer">yams.grpc.settrailer(name, value [, value, ...])</a></li>
+        <li><a href="#yams.grpc.send">yams.grpc.send(message)</a></li>
+      </ul>
+    </li>
+    <li><a href="#graphql">GraphQL resolvers</a></li>
+    <li><a href="#static">Static responses</a></li>
+    <li><a href="#javascript">JavaScript scripts</a></li>
     <li>
       <strong>local asset = yams.asset("path/to/asset")</strong>
       <ul>
@@ -73,6 +116,21 @@ yams.write([=[
         <li><a href="#base64.decode">base64.decode(data)</a></li>
       </ul>
     </li>
+    <li>
+      <strong>local crypto = require("crypto")</strong>
+      <ul>
+        <li><a href="#crypto.hash">crypto.md5|sha1|sha256|sha512(data [, encoding])</a></li>
+        <li><a href="#crypto.hmac">crypto.hmac(hash, key, data [, encoding])</a></li>
+        <li><a href="#crypto.random">crypto.random(size [, encoding])</a></li>
+        <li><a href="#crypto.hex">crypto.hex(data)</a></li>
+        <li><a href="#crypto.unhex">crypto.unhex(data)</a></li>
+        <li><a href="#crypto.equal">crypto.equal(a, b)</a></li>
+        <li><a href="#crypto.encrypt">crypto.encrypt(key, data [, encoding])</a></li>
+        <li><a href="#crypto.decrypt">crypto.decrypt(key, data [, encoding])</a></li>
+        <li><a href="#crypto.sign">crypto.sign(path, data [, hash [, encoding]])</a></li>
+        <li><a href="#crypto.verify">crypto.verify(path, data, signature [, hash [, encoding]])</a></li>
+      </ul>
+    </li>
   </ul>
 ]=])
 
@@ -116,6 +174,16 @@ yams.write([=[
             yams.write("Request host: " .. yams.host)
           </pre>
         </li>
+        <li>
+          <h4><a href="#yams.hostparams" name="yams.hostparams">yams.hostparams</a></h4>
+          <p>
+            Returns table with labels captured from the request host, if profile host is a pattern
+            (e.g. <em>{tenant}.mock.local</em>). Wildcard labels (e.g. <em>*.mock.local</em>) are not captured.
+          </p>
+          <pre>
+            yams.write("Tenant: " .. yams.hostparams.tenant)
+          </pre>
+        </li>
         <li>
           <h4><a href="#yams.uri" name="yams.uri">yams.uri</a></h4>
           <p>Returns request URI starting with forward slash (e.g. <em>/path/to/resource</em>, etc).</p>
@@ -146,9 +214,16 @@ yams.write([=[
         </li>
         <li>
           <h4><a href="#yams.path" name="yams.path">yams.path</a></h4>
-          <p>Returns table with request path parameters.</p>
+          <p>
+            Returns table with request path parameters. Parameter matches single path segment by default
+            (<code>{id}</code>) and can be constrained with a type (<em>int</em>, <em>float</em>, <em>uuid</em>,
+            <em>alpha</em>, <em>alnum</em>) or a regular expression (<code>{slug:[a-z-]+}</code>), or match the rest of
+            the path (<code>{rest...}</code>). Values of <em>int</em> and <em>float</em> parameters are numbers.
+          </p>
           <pre>
-            yams.write("Value of path parameter `param1`: ", yams.path.param1)
+            -- route path: /users/{id:int}/files/{name...}
+            yams.write("Value of path parameter `id`: ", yams.path.id + 1)
+            yams.write("Value of path parameter `name`: ", yams.path.name)
           </pre>
         </li>
         <li>
@@ -172,6 +247,23 @@ yams.write([=[
             yams.write("Value of cookie `cookie1`: ", yams.cookies.cookie1)
           </pre>
         </li>
+        <li>
+          <h4><a href="#yams.clientcert" name="yams.clientcert">yams.clientcert</a></h4>
+          <p>
+            Returns table with the client certificate, if it was requested by the profile on TLS proxy listener and presented by the client, otherwise <code>nil</code>.
+            Table contains <code>subject</code>, <code>issuer</code>, <code>serial</code>, lists of <code>dnsnames</code>, <code>emails</code>, <code>ips</code> and <code>uris</code>,
+            SHA-256 <code>fingerprint</code>, <code>notbefore</code> and <code>notafter</code> timestamps, and <code>verified</code> flag with verification <code>error</code> against trusted CA bundle of the profile.
+            Handshake is not failed for untrusted certificates, so rejection can be mocked by the script.
+          </p>
+          <pre>
+            local cert = yams.clientcert
+            if not cert or not cert.verified then
+              yams.setstatus(403)
+              yams.write("Client certificate rejected: ", cert and cert.error or "not presented")
+              yams.exit()
+            end
+          </pre>
+        </li>
         <li>
           <h4><a href="#yams.setstatus" name="yams.setstatus">yams.setstatus(code)</a></h4>
           <p>Sets response status code as per <code>code</code> argument. Can be overridden.</p>
@@ -238,11 +330,25 @@ yams.write([=[
         </li>
         <li>
           <h4><a href="#yams.sleep" name="yams.sleep">yams.sleep(seconds)</a></h4>
-          <p>Pauses script execution for the given number of <code>seconds</code>. Sleep duration cannot be higher than the defined route timeout.</p>
+          <p>
+            Pauses script execution for the given number of <code>seconds</code>, which may be fractional. Sleep duration cannot be higher than the defined route timeout.
+            Sleep is interrupted and script is stopped if client has disconnected.
+          </p>
           <pre>
             yams.sleep(15)
           </pre>
         </li>
+        <li>
+          <h4><a href="#yams.setbandwidth" name="yams.setbandwidth">yams.setbandwidth(rate [, ttfb])</a></h4>
+          <p>
+            Overrides route and profile bandwidth limit for the current response to <code>rate</code> bytes per second, where <code>0</code> means unlimited.
+            Optional <code>ttfb</code> sets the delay in milliseconds before the first byte of the response is sent.
+            The limit applies to the output buffer, assets and responses passed to the backend with <a href="#yams.pass">yams.pass</a>.
+          </p>
+          <pre>
+            yams.setbandwidth(8192, 500)
+          </pre>
+        </li>
         <li>
           <h4><a href="#yams.write" name="yams.write">yams.write(...)</a></h4>
           <p>
@@ -253,6 +359,35 @@ yams.write([=[
             yams.write("Hello world!")
           </pre>
         </li>
+        <li>
+          <h4><a href="#yams.flush" name="yams.flush">yams.flush()</a></h4>
+          <p>
+            Sends response status, headers and output buffer to the client, while script continues its execution within the route timeout.
+            Once flushed, response status, headers and cookies cannot be changed, and <a href="#yams.dump">yams.dump</a> and <a href="#yams.pass">yams.pass</a> are not available.
+            Raises an error if client has disconnected, which stops the script.
+          </p>
+          <pre>
+            for i = 1, 10 do
+              yams.write("Progress: ", i * 10, "%\n")
+              yams.flush()
+              yams.sleep(1)
+            end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.sse" name="yams.sse">yams.sse(event, data [, id])</a></h4>
+          <p>
+            Writes Server-Sent Event to the response output buffer and flushes it with <a href="#yams.flush">yams.flush</a>.
+            <code>event</code> can be <code>nil</code> for unnamed events. Tables passed as <code>data</code> are encoded to JSON.
+            <code>Content-Type</code> and <code>Cache-Control</code> headers are set for event stream, unless defined by the script.
+          </p>
+          <pre>
+            for i = 1, 5 do
+              yams.sse("tick", {count = i}, i)
+              yams.sleep(1)
+            end
+          </pre>
+        </li>
         <li>
           <h4><a href="#yams.getvar" name="yams.getvar">yams.getvar(name [, islocal])</a></h4>
           <p>
@@ -295,11 +430,44 @@ yams.write([=[
         </li>
         <li>
           <h4><a href="#yams.pass" name="yams.pass">yams.pass([url])</a></h4>
-          <p>Passes request to the backend if configured in the profile settings, otherwise requires <code>url</code> argument defined. This function stops script execution.</p>
+          <p>
+            Passes request to the backend if configured in the profile settings, otherwise requires <code>url</code> argument defined. This function stops script execution.
+            Upstream settings of the profile are applied, i.e. header rules, path prefixes, timeouts and TLS verification of the backend.
+          </p>
+          <p>
+            If profile has several backends, one of them is selected with round-robin, weighted or random balancing. Backend is ejected for a while after
+            consecutive connection errors or <code>502</code>, <code>503</code> and <code>504</code> responses, or failed health checks, and the request is
+            passed to the next backend. Selected backend is reported with <code>X-YAMS-Backend</code> header in debug mode.
+          </p>
           <pre>
             yams.pass("https://www.example.com")
           </pre>
         </li>
+        <li>
+          <h4><a href="#yams.fetch" name="yams.fetch">yams.fetch([url])</a></h4>
+          <p>
+            Passes request to the backend like <a href="#yams.pass">yams.pass</a>, but returns the backend response as a table with <code>status</code>,
+            <code>headers</code> and decompressed <code>body</code> fields instead of sending it, and continues script execution. Backend request is
+            bounded by the route timeout, and unavailable backend is reported with <code>502</code> status.
+          </p>
+          <pre>
+            local json = require("json")
+            local res = yams.fetch()
+            if res.status == 200 then
+              local data = json.decode(res.body)
+              data.name = "Mocked"
+              res.body = json.encode(data)
+            end
+            yams.send(res)
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.send" name="yams.send">yams.send(response)</a></h4>
+          <p>
+            Sets response status and headers from the table returned by <a href="#yams.fetch">yams.fetch</a>, and writes its body to the output buffer.
+            Headers of the table replace headers with the same names, which were set before.
+          </p>
+        </li>
         <li>
           <h4><a href="#yams.exit" name="yams.exit">yams.exit()</a></h4>
           <p>Stops script execution, similar to <code>do return end</code>.</p>
@@ -312,6 +480,270 @@ yams.write([=[
         </li>
       </ul>
     </li>
+    <li>
+      <h3>yams.ws</h3>
+      <p>
+        WebSocket connection of the request. Connection is upgraded by <a href="#yams.ws.upgrade">yams.ws.upgrade</a> or by the first call of any other function.
+        Once upgraded, response output buffer, status and headers are not sent, and connection is closed when script is finished or route timeout is reached.
+        Requests to the profile backend are passed with WebSocket connections, if no route is matched or <a href="#yams.pass">yams.pass</a> is called before upgrade.
+      </p>
+      <ul>
+        <li>
+          <h4><a href="#yams.ws.requested" name="yams.ws.requested">yams.ws.requested</a></h4>
+          <p><code>true</code> if the request is a WebSocket handshake.</p>
+          <pre>
+            if not yams.ws.requested then
+              yams.setstatus(426)
+              yams.exit()
+            end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.upgrade" name="yams.ws.upgrade">yams.ws.upgrade([protocol])</a></h4>
+          <p>
+            Upgrades connection to WebSocket with the optional subprotocol, and returns the selected subprotocol.
+            Headers and cookies set by the script are sent with the handshake response.
+          </p>
+          <pre>
+            yams.ws.upgrade("chat")
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.receive" name="yams.ws.receive">yams.ws.receive([timeout])</a></h4>
+          <p>
+            Waits for the next message, and returns its data and type (<code>"text"</code> or <code>"binary"</code>).
+            Returns <code>nil, "timeout"</code> if no message was received within <code>timeout</code> seconds,
+            or <code>nil, "close", code</code> if connection was closed by the client. Timers are fired while script waits for a message.
+          </p>
+          <pre>
+            while true do
+              local data, kind = yams.ws.receive()
+              if data == nil then break end
+              yams.ws.send("echo: " .. data, kind == "binary")
+            end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.send" name="yams.ws.send">yams.ws.send(data [, binary])</a></h4>
+          <p>Sends text message, or binary message if <code>binary</code> is <code>true</code>. Tables are encoded to JSON, and <em>asset</em> variables are sent with their data.</p>
+          <pre>
+            yams.ws.send({type = "hello", user = yams.getparam("user")})
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.close" name="yams.ws.close">yams.ws.close([code [, reason]])</a></h4>
+          <p>Sends close message with the given <code>code</code> (default <code>1000</code>) and <code>reason</code>.</p>
+          <pre>
+            yams.ws.close(4001, "unauthorized")
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.settimer" name="yams.ws.settimer">yams.ws.settimer(seconds, callback [, repeat])</a></h4>
+          <p>
+            Schedules <code>callback</code> to be called with timer id after the given number of <code>seconds</code>, or every <code>seconds</code> if <code>repeat</code> is <code>true</code>.
+            Returns timer id. Timers are fired only while script waits in <a href="#yams.ws.receive">yams.ws.receive</a>.
+          </p>
+          <pre>
+            yams.ws.settimer(5, function()
+              yams.ws.send("ping")
+            end, true)
+            while yams.ws.receive() do end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.ws.cleartimer" name="yams.ws.cleartimer">yams.ws.cleartimer(id)</a></h4>
+          <p>Cancels timer by <code>id</code>.</p>
+          <pre>
+            local id = yams.ws.settimer(10, function() yams.ws.close() end)
+            yams.ws.cleartimer(id)
+          </pre>
+        </li>
+      </ul>
+    </li>
+    <li>
+      <h3>yams.http</h3>
+      <p>
+        Outbound HTTP requests of the script. Only hosts from the allowlist of the profile can be requested, including redirects, and host without port in the allowlist
+        allows any port. URLs without port are matched with the default port of the scheme, e.g. <code>api.internal:443</code> allows <code>https://api.internal/</code>. Requests are bounded by the route timeout, and response is returned as a table with <code>status</code>, <code>headers</code> and
+        <code>body</code> fields, which can be sent with <a href="#yams.send">yams.send</a>. If request fails, <code>nil</code> and error message are returned.
+        Response body is limited to 10 MB.
+      </p>
+      <ul>
+        <li>
+          <h4><a href="#yams.http.request" name="yams.http.request">yams.http.request(options)</a></h4>
+          <p>
+            Sends request with <code>method</code> (<code>GET</code> by default), <code>url</code>, <code>headers</code>, <code>body</code> and
+            <code>timeout</code> in seconds options.
+          </p>
+          <pre>
+            local json = require("json")
+            local res, err = yams.http.request{
+              method = "PUT",
+              url = "http://callbacks.internal/orders/" .. yams.path.id,
+              headers = {["Content-Type"] = "application/json"},
+              body = json.encode({status = "paid"}),
+              timeout = 2.5,
+            }
+            if not res then
+              yams.setstatus(502)
+              yams.write(err)
+            end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.http.get" name="yams.http.get">yams.http.get(url [, headers])</a></h4>
+          <p>Sends <code>GET</code> request.</p>
+          <pre>
+            local res = yams.http.get("http://fixtures.mock.local/users/1")
+            yams.send(res)
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.http.post" name="yams.http.post">yams.http.post(url, body [, headers])</a></h4>
+          <p>Sends <code>POST</code> request.</p>
+          <pre>
+            yams.http.post("http://hooks.internal/notify", yams.getbody(), {["Content-Type"] = "application/json"})
+          </pre>
+        </li>
+      </ul>
+    </li>
+    <li>
+      <h3>yams.grpc</h3>
+      <p>
+        gRPC call served by the route with <code>grpc</code> adapter. Route path is the method path, e.g. <code>/package.Service/Method</code>, and messages are
+        mapped with the descriptor set asset configured in the profile (compiled with <code>protoc --include_imports --descriptor_set_out=protos.pb</code>).
+        Messages are converted to tables with protobuf JSON mapping, where field names are the ones defined in the proto files.
+        The table returned by the script is sent as the response message, and output buffer and HTTP status are ignored. Request metadata are available in <a href="#yams.headers">yams.headers</a>,
+        and response metadata can be set with <a href="#yams.setheader">yams.setheader</a> before the first message is sent.
+        gRPC clients connect to the proxy with HTTP/2 without TLS, or through the web server supporting HTTP/2 proxying (e.g. <code>grpc_pass</code> in <em>nginx</em>).
+        gRPC-Web is not supported. Call deadline sent by the client stops the script like the route timeout, and the call fails with <code>DEADLINE_EXCEEDED</code> status.
+      </p>
+      <ul>
+        <li>
+          <h4><a href="#yams.grpc.service" name="yams.grpc.service">yams.grpc.service</a></h4>
+          <p>Full name of the called service.</p>
+          <pre>
+            yams.grpc.service -- "helloworld.Greeter"
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.method" name="yams.grpc.method">yams.grpc.method</a></h4>
+          <p>Name of the called method.</p>
+          <pre>
+            yams.grpc.method -- "SayHello"
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.request" name="yams.grpc.request">yams.grpc.request</a></h4>
+          <p>The first request message, or <code>nil</code> if no message was received.</p>
+          <pre>
+            return {message = "Hello " .. yams.grpc.request.name}
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.requests" name="yams.grpc.requests">yams.grpc.requests</a></h4>
+          <p>All request messages of client-streaming calls.</p>
+          <pre>
+            return {count = #yams.grpc.requests}
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.codes" name="yams.grpc.codes">yams.grpc.codes</a></h4>
+          <p>gRPC status codes by their names, e.g. <code>yams.grpc.codes.NOT_FOUND</code>.</p>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.setstatus" name="yams.grpc.setstatus">yams.grpc.setstatus(code [, message])</a></h4>
+          <p>Sets gRPC status <code>code</code> and <code>message</code> of the call. Response message is not sent for error statuses.</p>
+          <pre>
+            yams.grpc.setstatus(yams.grpc.codes.NOT_FOUND, "user not found")
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.settrailer" name="yams.grpc.settrailer">yams.grpc.settrailer(name, value [, value, ...])</a></h4>
+          <p>Sets trailing metadata of the call. Reserved <code>grpc-*</code> trailers cannot be set.</p>
+          <pre>
+            yams.grpc.settrailer("x-request-cost", "42")
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#yams.grpc.send" name="yams.grpc.send">yams.grpc.send(message)</a></h4>
+          <p>Sends response message of server-streaming call immediately. Returned table, if any, is sent as the last message.</p>
+          <pre>
+            for i = 1, 5 do
+              yams.grpc.send({id = i})
+              yams.sleep(1)
+            end
+          </pre>
+        </li>
+      </ul>
+    </li>
+    <li>
+      <h3><a href="#graphql" name="graphql">GraphQL resolvers</a></h3>
+      <p>
+        Route with <code>graphql</code> adapter serves GraphQL queries and mutations with the schema asset in SDL format, configured in the profile.
+        Requests are accepted as JSON or <code>application/graphql</code> body, or as <code>GET</code> query parameters.
+        Script returns table of resolvers by type and field names. Resolver is a function, which receives field arguments and parent value tables, and returns field value, or a static value.
+        Fields without resolvers are read from the parent values, and other fields are generated with plausible values by their types and names, so queries of any shape can be mocked.
+        Objects of interfaces and unions are resolved by <code>__typename</code> field of the value. Resolvers can use <code>yams</code> module, e.g. storage variables and <a href="#yams.sessionid">yams.sessionid</a>.
+      </p>
+      <pre>
+        local yams = require("yams")
+
+        return {
+          Query = {
+            user = function(args)
+              return {id = args.id, name = yams.getvar("name", true) or "John"}
+            end,
+          },
+          Mutation = {
+            rename = function(args)
+              yams.setvar("name", args.name, true)
+              return {id = args.id, name = args.name}
+            end,
+          },
+          User = {
+            friends = function(args, parent)
+              return {{name = "Jane"}, {name = "Joe"}}
+            end,
+          },
+        }
+      </pre>
+    </li>
+    <li>
+      <h3><a href="#static" name="static">Static responses</a></h3>
+      <p>
+        Route with <code>static</code> adapter has no script and is served with the JSON document of the response: <code>status</code> (200 by default), <code>headers</code> with string or list of strings values,
+        <code>body</code> text or <code>asset</code> path, which mime type is used if <code>Content-Type</code> header is not set, and optional <code>delay</code> in milliseconds, which cannot be higher than the route timeout.
+        Route can be converted between <code>static</code> and <code>lua</code> adapters, if its script only sets status and headers, writes strings or single asset, and sleeps.
+      </p>
+      <pre>
+        {
+          "status": 201,
+          "headers": {"Content-Type": "application/json", "Set-Cookie": ["a=1", "b=2"]},
+          "body": "{\"id\": 1}",
+          "delay": 250
+        }
+      </pre>
+    </li>
+    <li>
+      <h3><a href="#javascript" name="javascript">JavaScript scripts</a></h3>
+      <p>
+        Route with <code>javascript</code> adapter runs ECMAScript 5.1 script with the same <code>yams</code> module, which is loaded with <code>require("yams")</code>, except <a href="#yams.ws">yams.ws</a>.
+        Missing values are returned as <code>null</code>, headers, query and form parameters are arrays indexed from 0, and variables are shared with Lua scripts as JSON. Modules <code>base64</code> and <code>crypto</code> are loaded with <code>require</code>, and <code>JSON</code> is built in.
+        Failed <code>crypto.unhex</code> and <code>crypto.decrypt</code> return <code>null</code>, and binary results should not be <code>"raw"</code> encoded.
+        Script is interrupted by the route timeout or if client has disconnected. Failed <a href="#yams.http">yams.http</a> requests throw errors.
+      </p>
+      <pre>
+        var yams = require("yams");
+
+        var user = yams.getvar("user", true) || {name: "John", visits: 0};
+        user.visits++;
+        yams.setvar("user", user, true);
+
+        yams.setheader("Content-Type", "application/json");
+        yams.write(JSON.stringify(user));
+      </pre>
+    </li>
   </ul>
   <ul>
     <li>
@@ -386,6 +818,86 @@ yams.write([=[
         </li>
       </ul>
     </li>
+    <li>
+      <h3>local crypto = require("crypto")</h3>
+      <p>
+        Library <code>crypto</code> is the extension that is used to hash, sign and encrypt strings. Binary results are encoded with <code>encoding</code>,
+        which is <code>"hex"</code> (default), <code>"base64"</code> or <code>"raw"</code>, and the same encoding is expected for decrypted data and verified signatures.
+      </p>
+      <ul>
+        <li>
+          <h4><a href="#crypto.hash" name="crypto.hash">crypto.md5|sha1|sha256|sha512(data [, encoding])</a></h4>
+          <p>Returns digest of <code>data</code>.</p>
+          <pre>
+            yams.setheader("ETag", crypto.sha1(yams.getbody() or ""))
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.hmac" name="crypto.hmac">crypto.hmac(hash, key, data [, encoding])</a></h4>
+          <p>Returns HMAC of <code>data</code> with <code>hash</code>, which is one of <code>"md5"</code>, <code>"sha1"</code>, <code>"sha256"</code> or <code>"sha512"</code>.</p>
+          <pre>
+            local body = yams.getbody()
+            local sig = crypto.hmac("sha256", "whsec_secret", body)
+            yams.http.post("http://shop.internal/webhooks", body, {["X-Signature"] = "sha256=" .. sig})
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.random" name="crypto.random">crypto.random(size [, encoding])</a></h4>
+          <p>Returns <code>size</code> cryptographically secure random bytes, up to 65536.</p>
+          <pre>
+            yams.write(json.encode({token = crypto.random(16)}))
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.hex" name="crypto.hex">crypto.hex(data)</a></h4>
+          <p>Returns hex encoded string from the given <code>data</code>.</p>
+        </li>
+        <li>
+          <h4><a href="#crypto.unhex" name="crypto.unhex">crypto.unhex(data)</a></h4>
+          <p>Returns decoded string from hex encoded <code>data</code>, or <code>nil</code> and error message.</p>
+        </li>
+        <li>
+          <h4><a href="#crypto.equal" name="crypto.equal">crypto.equal(a, b)</a></h4>
+          <p>Compares strings in constant time, so signatures can be checked without timing leaks.</p>
+          <pre>
+            local sig = crypto.hmac("sha256", "secret", yams.getbody())
+            if not crypto.equal(sig, yams.getheader("X-Signature")) then
+              yams.setstatus(401)
+              yams.exit()
+            end
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.encrypt" name="crypto.encrypt">crypto.encrypt(key, data [, encoding])</a></h4>
+          <p>Encrypts <code>data</code> with AES-GCM and 16, 24 or 32 bytes long <code>key</code>. Random nonce is prepended to the result.</p>
+          <pre>
+            local token = crypto.encrypt("0123456789abcdef", yams.sessionid, "base64")
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.decrypt" name="crypto.decrypt">crypto.decrypt(key, data [, encoding])</a></h4>
+          <p>Decrypts <code>data</code> returned by <a href="#crypto.encrypt">crypto.encrypt</a>, or returns <code>nil</code> and error message.</p>
+        </li>
+        <li>
+          <h4><a href="#crypto.sign" name="crypto.sign">crypto.sign(path, data [, hash [, encoding]])</a></h4>
+          <p>
+            Signs <code>data</code> with RSA (PKCS #1 v1.5) or ECDSA private key from the PEM asset at <code>path</code>. Default <code>hash</code> is <code>"sha256"</code>.
+          </p>
+          <pre>
+            yams.setheader("X-Signature", crypto.sign("keys/gateway.pem", yams.getbody(), "sha256", "base64"))
+          </pre>
+        </li>
+        <li>
+          <h4><a href="#crypto.verify" name="crypto.verify">crypto.verify(path, data, signature [, hash [, encoding]])</a></h4>
+          <p>Returns <code>true</code> if <code>signature</code> is valid for the public key, certificate or private key from the PEM asset at <code>path</code>.</p>
+          <pre>
+            if not crypto.verify("keys/client.crt", yams.getbody(), yams.getheader("X-Signature"), "sha256", "base64") then
+              yams.setstatus(401)
+            end
+          </pre>
+        </li>
+      </ul>
+    </li>
   </ul>]=])
 
 yams.write(string.format([=[
@@ -0,0 +1,169 @@
+-- Upgrades database of the previous release to the schema in yams.sql. Run it with psql before starting the new version
+-- (not in a single transaction, as new enum values cannot be added in a transaction block before PostgreSQL 12):
+--
+--   $ psql -d yams -f docs/upgrade.sql
+------------------------------------------------------------------------------------------------------------------------
+ALTER TYPE adapter ADD VALUE IF NOT EXISTS 'grpc';
+ALTER TYPE adapter ADD VALUE IF NOT EXISTS 'graphql';
+ALTER TYPE adapter ADD VALUE IF NOT EXISTS 'static';
+ALTER TYPE adapter ADD VALUE IF NOT EXISTS 'javascript';
+
+DO $$
+BEGIN
+  CREATE TYPE client_auth AS ENUM('request', 'require');
+EXCEPTION
+  WHEN duplicate_object THEN NULL;
+END;
+$$;
+------------------------------------------------------------------------------------------------------------------------
+ALTER TABLE profiles
+  ADD COLUMN IF NOT EXISTS backends          jsonb DEFAULT '[]'::jsonb   NOT NULL,
+  ADD COLUMN IF NOT EXISTS balancing         jsonb DEFAULT '{}'::jsonb   NOT NULL,
+  ADD COLUMN IF NOT EXISTS is_journal        boolean DEFAULT FALSE       NOT NULL,
+  ADD COLUMN IF NOT EXISTS is_recording      boolean DEFAULT FALSE       NOT NULL,
+  ADD COLUMN IF NOT EXISTS is_validating     boolean DEFAULT FALSE       NOT NULL,
+  ADD COLUMN IF NOT EXISTS journal_lifetime  integer DEFAULT 86400       NOT NULL,
+  ADD COLUMN IF NOT EXISTS validation_status integer DEFAULT 400,
+  ADD COLUMN IF NOT EXISTS faults            jsonb DEFAULT '[]'::jsonb   NOT NULL,
+  ADD COLUMN IF NOT EXISTS bandwidth         integer,
+  ADD COLUMN IF NOT EXISTS ttfb              integer,
+  ADD COLUMN IF NOT EXISTS descriptor_set    varchar(72),
+  ADD COLUMN IF NOT EXISTS graphql_schema    varchar(72),
+  ADD COLUMN IF NOT EXISTS tls_cert          varchar(72),
+  ADD COLUMN IF NOT EXISTS tls_key           varchar(72),
+  ADD COLUMN IF NOT EXISTS client_auth       client_auth,
+  ADD COLUMN IF NOT EXISTS client_ca         varchar(72),
+  ADD COLUMN IF NOT EXISTS upstream          jsonb DEFAULT '{}'::jsonb   NOT NULL,
+  ADD COLUMN IF NOT EXISTS http_allowlist    varchar(128)[] DEFAULT '{}' NOT NULL,
+  ADD COLUMN IF NOT EXISTS spec              jsonb;
+
+ALTER TABLE routes
+  ADD COLUMN IF NOT EXISTS conditions     jsonb DEFAULT '[]'::jsonb NOT NULL,
+  ADD COLUMN IF NOT EXISTS faults         jsonb DEFAULT '[]'::jsonb NOT NULL,
+  ADD COLUMN IF NOT EXISTS bandwidth      integer,
+  ADD COLUMN IF NOT EXISTS ttfb           integer,
+  ADD COLUMN IF NOT EXISTS spec_operation varchar(255),
+  ADD COLUMN IF NOT EXISTS spec_hash      char(40),
+  -- paths are parsed by the proxy, which supports typed parameters
+  DROP COLUMN IF EXISTS path_re,
+  DROP COLUMN IF EXISTS path_args;
+------------------------------------------------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS journal
+(
+  id             bigserial                           NOT NULL
+    CONSTRAINT journal_pkey
+    PRIMARY KEY,
+  profile_id     integer                             NOT NULL
+    CONSTRAINT journal_profiles_id_fk
+    REFERENCES profiles
+    ON DELETE CASCADE,
+  route_uuid     uuid,
+  sid            varchar(24),
+  method         varchar(16)                         NOT NULL,
+  host           varchar(255)                        NOT NULL,
+  uri            varchar(4096)                       NOT NULL,
+  ip             varchar(64)                         NOT NULL,
+  req_headers    jsonb                               NOT NULL,
+  req_body       bytea                               NOT NULL,
+  status         integer                             NOT NULL,
+  res_headers    jsonb                               NOT NULL,
+  res_body       bytea                               NOT NULL,
+  is_intercepted boolean                             NOT NULL,
+  backend        varchar(2048),
+  duration       double precision                    NOT NULL,
+  created_at     timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS journal_profile_id_created_at_index ON journal (profile_id, created_at);
+------------------------------------------------------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS recordings
+(
+  id         bigserial                           NOT NULL
+    CONSTRAINT recordings_pkey
+    PRIMARY KEY,
+  profile_id integer                             NOT NULL
+    CONSTRAINT recordings_profiles_id_fk
+    REFERENCES profiles
+    ON DELETE CASCADE,
+  method     varchar(16)                         NOT NULL,
+  path       varchar(2048)                       NOT NULL,
+  query      varchar(4096)                       NOT NULL,
+  status     integer                             NOT NULL,
+  headers    jsonb                               NOT NULL,
+  body       bytea                               NOT NULL,
+  created_at timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS recordings_profile_id_index ON recordings (profile_id);
+------------------------------------------------------------------------------------------------------------------------
+CREATE OR REPLACE FUNCTION yams_profiles_robot() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.hosts = ARRAY(SELECT DISTINCT regexp_replace(lower(unnest(NEW.hosts)), ':(?:80|443)$', '') AS x ORDER BY x);
+  NEW.http_allowlist = ARRAY(SELECT DISTINCT lower(unnest(NEW.http_allowlist)) AS x ORDER BY x);
+  NEW.backends = COALESCE((SELECT jsonb_agg(jsonb_set(b, '{url}', to_jsonb(rtrim(regexp_replace(lower(b->>'url'), '^((?:[^\/]*\/){3}).*', '\1'), '/'))) ORDER BY i)
+                           FROM jsonb_array_elements(NEW.backends) WITH ORDINALITY AS x(b, i)), '[]'::jsonb);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- single backend of the profile becomes the first one of the backends list
+DO $$
+BEGIN
+  IF EXISTS(SELECT FROM information_schema.columns WHERE table_name = 'profiles' AND column_name = 'backend') THEN
+    UPDATE profiles SET backends = jsonb_build_array(jsonb_build_object('url', backend)) WHERE backend IS NOT NULL;
+    ALTER TABLE profiles DROP COLUMN backend;
+  END IF;
+END;
+$$;
+------------------------------------------------------------------------------------------------------------------------
+CREATE OR REPLACE FUNCTION yams_routes_robot() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.methods = ARRAY(SELECT DISTINCT upper(unnest(NEW.methods)) AS x ORDER BY x);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+------------------------------------------------------------------------------------------------------------------------
+CREATE OR REPLACE FUNCTION yams_profiles_notify() RETURNS TRIGGER AS $$
+DECLARE
+  rec RECORD;
+BEGIN
+  IF tg_op = 'DELETE' THEN
+    rec = OLD;
+  ELSE
+    rec = NEW;
+  END IF;
+  IF tg_table_name = 'profiles' THEN
+    PERFORM pg_notify('yams_profiles', rec.id::text);
+  ELSE
+    PERFORM pg_notify('yams_profiles', rec.profile_id::text);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS profiles_notify ON profiles;
+CREATE TRIGGER profiles_notify AFTER INSERT OR UPDATE OR DELETE ON profiles
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+
+DROP TRIGGER IF EXISTS routes_notify ON routes;
+CREATE TRIGGER routes_notify AFTER INSERT OR UPDATE OR DELETE ON routes
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+
+DROP TRIGGER IF EXISTS assets_notify ON assets;
+CREATE TRIGGER assets_notify AFTER INSERT OR UPDATE OR DELETE ON assets
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+------------------------------------------------------------------------------------------------------------------------
+CREATE OR REPLACE FUNCTION yams_journal_recycle() RETURNS TRIGGER AS $$
+BEGIN
+  -- expired entries are deleted in small batches of the profile, which uses journal index
+  DELETE FROM journal WHERE id IN (
+    SELECT j.id FROM journal j JOIN profiles p ON p.id = j.profile_id
+    WHERE j.profile_id = NEW.profile_id AND j.created_at <= now() - p.journal_lifetime * INTERVAL '1 second'
+    LIMIT 100);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journal_recycle ON journal;
+CREATE TRIGGER journal_recycle AFTER INSERT ON journal
+  FOR EACH ROW EXECUTE PROCEDURE yams_journal_recycle();
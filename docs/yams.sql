@@ -1,41 +1,64 @@
 CREATE EXTENSION "pgcrypto";
 ------------------------------------------------------------------------------------------------------------------------
-CREATE TYPE adapter AS ENUM('lua');
+CREATE TYPE adapter AS ENUM('lua', 'grpc', 'graphql', 'static', 'javascript');
 CREATE TYPE role AS ENUM('developer', 'manager', 'admin');
+CREATE TYPE client_auth AS ENUM('request', 'require');
 ------------------------------------------------------------------------------------------------------------------------
 CREATE TABLE profiles
 (
-  id            serial                              NOT NULL
+  id                serial                              NOT NULL
     CONSTRAINT profiles_pkey
     PRIMARY KEY,
-  name          varchar(72)                         NOT NULL,
-  backend       varchar(128),
-  hosts         varchar(128)[]                      NOT NULL,
-  is_debug      boolean DEFAULT TRUE                NOT NULL,
-  vars_lifetime integer DEFAULT 86400               NOT NULL,
-  created_at    timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+  name              varchar(72)                         NOT NULL,
+  backends          jsonb DEFAULT '[]'::jsonb           NOT NULL,
+  balancing         jsonb DEFAULT '{}'::jsonb           NOT NULL,
+  hosts             varchar(128)[]                      NOT NULL,
+  is_debug          boolean DEFAULT TRUE                NOT NULL,
+  is_journal        boolean DEFAULT FALSE               NOT NULL,
+  is_recording      boolean DEFAULT FALSE               NOT NULL,
+  is_validating     boolean DEFAULT FALSE               NOT NULL,
+  vars_lifetime     integer DEFAULT 86400               NOT NULL,
+  journal_lifetime  integer DEFAULT 86400               NOT NULL,
+  validation_status integer DEFAULT 400,
+  faults            jsonb DEFAULT '[]'::jsonb           NOT NULL,
+  bandwidth         integer,
+  ttfb              integer,
+  descriptor_set    varchar(72),
+  graphql_schema    varchar(72),
+  tls_cert          varchar(72),
+  tls_key           varchar(72),
+  client_auth       client_auth,
+  client_ca         varchar(72),
+  upstream          jsonb DEFAULT '{}'::jsonb           NOT NULL,
+  http_allowlist    varchar(128)[] DEFAULT '{}'         NOT NULL,
+  spec              jsonb,
+  created_at        timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
 );
 ------------------------------------------------------------------------------------------------------------------------
 CREATE TABLE routes
 (
-  id         serial                           NOT NULL
+  id             serial                           NOT NULL
     CONSTRAINT routes_pkey
     PRIMARY KEY,
-  uuid       uuid DEFAULT gen_random_uuid()   NOT NULL,
-  profile_id integer                          NOT NULL
+  uuid           uuid DEFAULT gen_random_uuid()   NOT NULL,
+  profile_id     integer                          NOT NULL
     CONSTRAINT routes_profiles_id_fk
     REFERENCES profiles
     ON DELETE CASCADE,
-  methods    varchar(16)[]                    NOT NULL,
-  path       varchar(2048)                    NOT NULL,
-  path_re    varchar(4096)                    NOT NULL,
-  path_args  varchar(2048)[]                  NOT NULL,
-  script     bytea DEFAULT '\x'::bytea        NOT NULL,
-  position   integer                          NOT NULL,
-  timeout    integer DEFAULT 60               NOT NULL,
-  hint       varchar(255),
-  adapter    adapter DEFAULT 'lua'::adapter   NOT NULL,
-  is_enabled boolean DEFAULT TRUE             NOT NULL
+  methods        varchar(16)[]                    NOT NULL,
+  path           varchar(2048)                    NOT NULL,
+  conditions     jsonb DEFAULT '[]'::jsonb        NOT NULL,
+  faults         jsonb DEFAULT '[]'::jsonb        NOT NULL,
+  script         bytea DEFAULT '\x'::bytea        NOT NULL,
+  position       integer                          NOT NULL,
+  timeout        integer DEFAULT 60               NOT NULL,
+  bandwidth      integer,
+  ttfb           integer,
+  hint           varchar(255),
+  adapter        adapter DEFAULT 'lua'::adapter   NOT NULL,
+  spec_operation varchar(255),
+  spec_hash      char(40),
+  is_enabled     boolean DEFAULT TRUE             NOT NULL
 );
 
 CREATE UNIQUE INDEX routes_uuid_uindex ON routes (uuid);
@@ -72,6 +95,54 @@ CREATE TABLE storage
 
 CREATE UNIQUE INDEX storage_profile_id_sid_key_uindex ON storage (profile_id, COALESCE(sid, ''::varchar), key);
 ------------------------------------------------------------------------------------------------------------------------
+CREATE TABLE journal
+(
+  id             bigserial                           NOT NULL
+    CONSTRAINT journal_pkey
+    PRIMARY KEY,
+  profile_id     integer                             NOT NULL
+    CONSTRAINT journal_profiles_id_fk
+    REFERENCES profiles
+    ON DELETE CASCADE,
+  route_uuid     uuid,
+  sid            varchar(24),
+  method         varchar(16)                         NOT NULL,
+  host           varchar(255)                        NOT NULL,
+  uri            varchar(4096)                       NOT NULL,
+  ip             varchar(64)                         NOT NULL,
+  req_headers    jsonb                               NOT NULL,
+  req_body       bytea                               NOT NULL,
+  status         integer                             NOT NULL,
+  res_headers    jsonb                               NOT NULL,
+  res_body       bytea                               NOT NULL,
+  is_intercepted boolean                             NOT NULL,
+  backend        varchar(2048),
+  duration       double precision                    NOT NULL,
+  created_at     timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX journal_profile_id_created_at_index ON journal (profile_id, created_at);
+------------------------------------------------------------------------------------------------------------------------
+CREATE TABLE recordings
+(
+  id         bigserial                           NOT NULL
+    CONSTRAINT recordings_pkey
+    PRIMARY KEY,
+  profile_id integer                             NOT NULL
+    CONSTRAINT recordings_profiles_id_fk
+    REFERENCES profiles
+    ON DELETE CASCADE,
+  method     varchar(16)                         NOT NULL,
+  path       varchar(2048)                       NOT NULL,
+  query      varchar(4096)                       NOT NULL,
+  status     integer                             NOT NULL,
+  headers    jsonb                               NOT NULL,
+  body       bytea                               NOT NULL,
+  created_at timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX recordings_profile_id_index ON recordings (profile_id);
+------------------------------------------------------------------------------------------------------------------------
 CREATE TABLE users
 (
   id           serial                              NOT NULL
@@ -104,7 +175,9 @@ CREATE TABLE acl
 CREATE FUNCTION yams_profiles_robot() RETURNS TRIGGER AS $$
 BEGIN
   NEW.hosts = ARRAY(SELECT DISTINCT regexp_replace(lower(unnest(NEW.hosts)), ':(?:80|443)$', '') AS x ORDER BY x);
-  NEW.backend = rtrim(regexp_replace(lower(NEW.backend), '^((?:[^\/]*\/){3}).*', '\1'), '/');
+  NEW.http_allowlist = ARRAY(SELECT DISTINCT lower(unnest(NEW.http_allowlist)) AS x ORDER BY x);
+  NEW.backends = COALESCE((SELECT jsonb_agg(jsonb_set(b, '{url}', to_jsonb(rtrim(regexp_replace(lower(b->>'url'), '^((?:[^\/]*\/){3}).*', '\1'), '/'))) ORDER BY i)
+                           FROM jsonb_array_elements(NEW.backends) WITH ORDINALITY AS x(b, i)), '[]'::jsonb);
   RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
@@ -115,9 +188,6 @@ CREATE TRIGGER profiles_robot BEFORE INSERT OR UPDATE ON profiles
 CREATE FUNCTION yams_routes_robot() RETURNS TRIGGER AS $$
 BEGIN
   NEW.methods = ARRAY(SELECT DISTINCT upper(unnest(NEW.methods)) AS x ORDER BY x);
-  NEW.path_re = '^' || regexp_replace(
-      regexp_replace(NEW.path, '([!$()*+.:<=>?[\\\]^{|}-])', '\\\1', 'g'), '\\\{\w+\\\}', '(.*)', 'g') || '$';
-  NEW.path_args = ARRAY(SELECT unnest(regexp_matches(NEW.path, '\{(\w+)\}', 'g')));
   RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
@@ -156,6 +226,33 @@ $$ LANGUAGE plpgsql;
 CREATE TRIGGER routes_position BEFORE INSERT OR UPDATE OR DELETE ON routes
   FOR EACH ROW WHEN (pg_trigger_depth() = 0) EXECUTE PROCEDURE yams_routes_position();
 ------------------------------------------------------------------------------------------------------------------------
+CREATE FUNCTION yams_profiles_notify() RETURNS TRIGGER AS $$
+DECLARE
+  rec RECORD;
+BEGIN
+  IF tg_op = 'DELETE' THEN
+    rec = OLD;
+  ELSE
+    rec = NEW;
+  END IF;
+  IF tg_table_name = 'profiles' THEN
+    PERFORM pg_notify('yams_profiles', rec.id::text);
+  ELSE
+    PERFORM pg_notify('yams_profiles', rec.profile_id::text);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER profiles_notify AFTER INSERT OR UPDATE OR DELETE ON profiles
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+
+CREATE TRIGGER routes_notify AFTER INSERT OR UPDATE OR DELETE ON routes
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+
+CREATE TRIGGER assets_notify AFTER INSERT OR UPDATE OR DELETE ON assets
+  FOR EACH ROW EXECUTE PROCEDURE yams_profiles_notify();
+------------------------------------------------------------------------------------------------------------------------
 CREATE FUNCTION yams_storage_robot() RETURNS TRIGGER AS $$
 BEGIN
   NEW.updated_at = now();
@@ -176,6 +273,20 @@ $$ LANGUAGE plpgsql;
 CREATE TRIGGER storage_recycle AFTER INSERT OR UPDATE ON storage
   FOR STATEMENT EXECUTE PROCEDURE yams_storage_recycle();
 ------------------------------------------------------------------------------------------------------------------------
+CREATE FUNCTION yams_journal_recycle() RETURNS TRIGGER AS $$
+BEGIN
+  -- expired entries are deleted in small batches of the profile, which uses journal index
+  DELETE FROM journal WHERE id IN (
+    SELECT j.id FROM journal j JOIN profiles p ON p.id = j.profile_id
+    WHERE j.profile_id = NEW.profile_id AND j.created_at <= now() - p.journal_lifetime * INTERVAL '1 second'
+    LIMIT 100);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_recycle AFTER INSERT ON journal
+  FOR EACH ROW EXECUTE PROCEDURE yams_journal_recycle();
+------------------------------------------------------------------------------------------------------------------------
 CREATE FUNCTION yams_users_robot() RETURNS TRIGGER AS $$
 BEGIN
   NEW.username = lower(NEW.username);
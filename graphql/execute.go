@@ -0,0 +1,441 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/vektah/gqlparser"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/gqlerror"
+	"github.com/vektah/gqlparser/validator"
+)
+
+// Number of items in sampled lists.
+const sampleListSize = 2
+
+// Limits of the executed query, so nested lists cannot exhaust memory.
+const (
+	maxDepth  = 32
+	maxValues = 100000
+)
+
+// Resolver returns value of the object field, and reports false if the field
+// has no resolver, so its value is taken from the parent or sampled.
+type Resolver func(typ, field string, args map[string]interface{}, parent interface{}) (interface{}, bool, error)
+
+// Object is implemented by values, which fields are read by the executor.
+type Object interface {
+	Field(name string) (interface{}, bool)
+}
+
+// List is implemented by values, which items are read by the executor.
+type List interface {
+	Items() []interface{}
+}
+
+type executor struct {
+	ctx     context.Context
+	schema  *ast.Schema
+	vars    map[string]interface{}
+	resolve Resolver
+	errors  []*Error
+	id      int
+	values  int
+
+	// err stops execution, e.g. if context is done or limits are exceeded
+	err error
+}
+
+// Execute runs the request against the schema. Fields without resolvers are
+// read from the parent values, or sampled if parent has no such fields.
+// Execution is stopped if context is done.
+func Execute(ctx context.Context, schema *ast.Schema, req *Request, resolve Resolver) *Response {
+	doc, errs := gqlparser.LoadQuery(schema, req.Query)
+	if len(errs) > 0 {
+		return &Response{Errors: convertErrors(errs)}
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		if req.OperationName == "" {
+			return errorResponse("operation name is required for documents with multiple operations")
+		}
+		return errorResponse(fmt.Sprintf("operation %q is not found", req.OperationName))
+	}
+	vars, err := validator.VariableValues(schema, op, req.Variables)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var root *ast.Definition
+	switch op.Operation {
+	case ast.Query:
+		root = schema.Query
+	case ast.Mutation:
+		root = schema.Mutation
+	default:
+		return errorResponse(fmt.Sprintf("%s operations are not supported", op.Operation))
+	}
+	if root == nil {
+		return errorResponse(fmt.Sprintf("schema does not support %s operations", op.Operation))
+	}
+
+	e := &executor{ctx: ctx, schema: schema, vars: vars, resolve: resolve}
+	res := &Response{Data: json.RawMessage("null")}
+	if data, ok := e.executeFields(root, nil, op.SelectionSet, nil); ok {
+		res.Data = data
+	}
+	if e.err != nil {
+		return errorResponse(e.err.Error())
+	}
+	res.Errors = e.errors
+	return res
+}
+
+func errorResponse(msg string) *Response {
+	return &Response{Errors: []*Error{{Message: msg}}}
+}
+
+func convertErrors(errs gqlerror.List) []*Error {
+	out := make([]*Error, len(errs))
+	for i, err := range errs {
+		out[i] = &Error{Message: err.Message, Locations: err.Locations}
+	}
+	return out
+}
+
+func (e *executor) error(f *ast.Field, path []interface{}, msg string) {
+	err := &Error{Message: msg, Path: path}
+	if f.Position != nil {
+		err.Locations = []gqlerror.Location{{Line: f.Position.Line, Column: f.Position.Column}}
+	}
+	e.errors = append(e.errors, err)
+}
+
+// Reports false if the field is null, but its type is non-null, so the null
+// must be propagated to the parent field.
+func (e *executor) executeFields(obj *ast.Definition, parent interface{}, sel ast.SelectionSet, path []interface{}) (*object, bool) {
+	if e.err == nil {
+		depth := 0
+		for _, p := range path {
+			if _, ok := p.(string); ok {
+				depth++
+			}
+		}
+		if depth > maxDepth {
+			e.err = fmt.Errorf("query exceeds maximum depth of %d", maxDepth)
+		} else if err := e.ctx.Err(); err != nil {
+			e.err = err
+		}
+	}
+	if e.err != nil {
+		return nil, false
+	}
+
+	fields := &object{values: make(map[string]interface{})}
+	e.collectFields(obj, sel, fields, make(map[string]bool))
+
+	out := &object{values: make(map[string]interface{})}
+	for _, key := range fields.keys {
+		ff := fields.values[key].([]*ast.Field)
+		if ff[0].Name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+
+		fpath := append(append([]interface{}(nil), path...), key)
+		def := obj.Fields.ForName(ff[0].Name)
+		if def == nil {
+			e.error(ff[0], fpath, fmt.Sprintf("field %s is not supported", ff[0].Name))
+			out.set(key, nil)
+			continue
+		}
+		v, ok := e.resolveField(obj, def, ff, parent, fpath)
+		if !ok {
+			return nil, false
+		}
+		out.set(key, v)
+	}
+	return out, true
+}
+
+// Groups selected fields by their response keys, applying fragments.
+func (e *executor) collectFields(obj *ast.Definition, sel ast.SelectionSet, fields *object, visited map[string]bool) {
+	for _, s := range sel {
+		switch s := s.(type) {
+		case *ast.Field:
+			if !e.include(s.Directives) {
+				continue
+			}
+			key := s.Alias
+			if key == "" {
+				key = s.Name
+			}
+			ff, _ := fields.values[key].([]*ast.Field)
+			fields.set(key, append(ff, s))
+		case *ast.FragmentSpread:
+			if !e.include(s.Directives) || visited[s.Name] || s.Definition == nil {
+				continue
+			}
+			visited[s.Name] = true
+			if e.applies(obj, s.Definition.TypeCondition) {
+				e.collectFields(obj, s.Definition.SelectionSet, fields, visited)
+			}
+		case *ast.InlineFragment:
+			if !e.include(s.Directives) {
+				continue
+			}
+			if s.TypeCondition == "" || e.applies(obj, s.TypeCondition) {
+				e.collectFields(obj, s.SelectionSet, fields, visited)
+			}
+		}
+	}
+}
+
+func (e *executor) include(directives ast.DirectiveList) bool {
+	if d := directives.ForName("skip"); d != nil {
+		if skip, _ := d.ArgumentMap(e.vars)["if"].(bool); skip {
+			return false
+		}
+	}
+	if d := directives.ForName("include"); d != nil {
+		if include, _ := d.ArgumentMap(e.vars)["if"].(bool); !include {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether fragment type condition applies to the object type.
+func (e *executor) applies(obj *ast.Definition, cond string) bool {
+	if cond == obj.Name {
+		return true
+	}
+	if def := e.schema.Types[cond]; def != nil {
+		for _, t := range e.schema.GetPossibleTypes(def) {
+			if t.Name == obj.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *executor) resolveField(obj *ast.Definition, def *ast.FieldDefinition, ff []*ast.Field, parent interface{}, path []interface{}) (interface{}, bool) {
+	var v interface{}
+	var found bool
+	if e.resolve != nil {
+		var err error
+		if v, found, err = e.resolve(obj.Name, def.Name, ff[0].ArgumentMap(e.vars), parent); err != nil {
+			e.error(ff[0], path, err.Error())
+			return nil, !def.Type.NonNull
+		}
+	}
+	if !found {
+		v, found = field(parent, def.Name)
+	}
+	return e.completeValue(def.Type, ff, v, !found, def.Name, path)
+}
+
+// Completes resolved value by its type, or samples it if the value is not
+// defined.
+func (e *executor) completeValue(t *ast.Type, ff []*ast.Field, v interface{}, sample bool, name string, path []interface{}) (interface{}, bool) {
+	if e.values++; e.values > maxValues && e.err == nil {
+		e.err = fmt.Errorf("query exceeds maximum of %d values", maxValues)
+	}
+	if e.err != nil {
+		return nil, false
+	}
+	if v == nil && !sample {
+		if t.NonNull {
+			e.error(ff[0], path, fmt.Sprintf("non-null field %s resolved to null", name))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if t.Elem != nil {
+		var items []interface{}
+		if sample {
+			items = make([]interface{}, sampleListSize)
+		} else if l, ok := v.(List); ok {
+			items = l.Items()
+		} else if l, ok := v.([]interface{}); ok {
+			items = l
+		} else {
+			e.error(ff[0], path, fmt.Sprintf("field %s must be a list", name))
+			return nil, !t.NonNull
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			iv, ok := e.completeValue(t.Elem, ff, item, sample, name, append(append([]interface{}(nil), path...), i))
+			if !ok {
+				return nil, !t.NonNull
+			}
+			out[i] = iv
+		}
+		return out, true
+	}
+
+	def := e.schema.Types[t.NamedType]
+	if def == nil {
+		e.error(ff[0], path, fmt.Sprintf("unknown type %s", t.NamedType))
+		return nil, !t.NonNull
+	}
+	switch def.Kind {
+	case ast.Scalar, ast.Enum:
+		if sample {
+			return e.sample(def, name), true
+		}
+		sv, err := coerce(def, v)
+		if err != nil {
+			e.error(ff[0], path, fmt.Sprintf("field %s: %v", name, err))
+			return nil, !t.NonNull
+		}
+		return sv, true
+	}
+
+	if def.Kind == ast.Interface || def.Kind == ast.Union {
+		if def = e.concreteType(def, v); def == nil {
+			e.error(ff[0], path, fmt.Sprintf("type of field %s cannot be resolved", name))
+			return nil, !t.NonNull
+		}
+	}
+	var sel ast.SelectionSet
+	for _, f := range ff {
+		sel = append(sel, f.SelectionSet...)
+	}
+	obj, ok := e.executeFields(def, v, sel, path)
+	if !ok {
+		return nil, !t.NonNull
+	}
+	return obj, true
+}
+
+// Resolves object type of the abstract type value by its "__typename" field,
+// or takes the first possible type.
+func (e *executor) concreteType(def *ast.Definition, v interface{}) *ast.Definition {
+	types := e.schema.GetPossibleTypes(def)
+	if name, ok := field(v, "__typename"); ok {
+		for _, t := range types {
+			if t.Name == fmt.Sprint(name) {
+				return t
+			}
+		}
+		return nil
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	return types[0]
+}
+
+func field(parent interface{}, name string) (interface{}, bool) {
+	switch p := parent.(type) {
+	case Object:
+		return p.Field(name)
+	case map[string]interface{}:
+		v, ok := p[name]
+		return v, ok
+	}
+	return nil, false
+}
+
+// Coerces resolved value to the scalar or enum type.
+func coerce(def *ast.Definition, v interface{}) (interface{}, error) {
+	if def.Kind == ast.Enum {
+		s, ok := v.(string)
+		if ok {
+			for _, ev := range def.EnumValues {
+				if ev.Name == s {
+					return s, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("invalid value %v for enum %s", v, def.Name)
+	}
+
+	switch def.Name {
+	case "Int":
+		if f, ok := number(v); ok && f == math.Trunc(f) && f >= math.MinInt32 && f <= math.MaxInt32 {
+			return int64(f), nil
+		}
+		return nil, fmt.Errorf("invalid Int value %v", v)
+	case "Float":
+		if f, ok := number(v); ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid Float value %v", v)
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("invalid Boolean value %v", v)
+	case "String", "ID":
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		if f, ok := number(v); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		return nil, fmt.Errorf("invalid %s value %v", def.Name, v)
+	}
+	// custom scalars are serialized as is
+	return v, nil
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// object keeps JSON object keys in the order of selection.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *object) set(key string, v interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, _ := json.Marshal(key)
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,133 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/ast"
+)
+
+const sampleTime = "2020-01-01T12:00:00Z"
+
+// Sample strings by the parts of field names, longer parts go first.
+var sampleStrings = []struct {
+	part  string
+	value string
+}{
+	{"firstname", "John"},
+	{"lastname", "Doe"},
+	{"surname", "Doe"},
+	{"username", "johndoe"},
+	{"email", "john.doe@example.com"},
+	{"avatar", "https://example.com/avatar.png"},
+	{"image", "https://example.com/image.png"},
+	{"photo", "https://example.com/photo.png"},
+	{"website", "https://example.com"},
+	{"url", "https://example.com"},
+	{"uri", "https://example.com"},
+	{"link", "https://example.com"},
+	{"phone", "+44 20 7946 0000"},
+	{"description", "Lorem ipsum dolor sit amet, consectetur adipiscing elit."},
+	{"summary", "Lorem ipsum dolor sit amet."},
+	{"content", "Lorem ipsum dolor sit amet, consectetur adipiscing elit."},
+	{"comment", "Lorem ipsum dolor sit amet."},
+	{"message", "Lorem ipsum dolor sit amet."},
+	{"body", "Lorem ipsum dolor sit amet, consectetur adipiscing elit."},
+	{"text", "Lorem ipsum dolor sit amet."},
+	{"title", "Lorem ipsum"},
+	{"address", "221B Baker Street"},
+	{"street", "221B Baker Street"},
+	{"city", "London"},
+	{"country", "United Kingdom"},
+	{"postcode", "NW1 6XE"},
+	{"zip", "NW1 6XE"},
+	{"currency", "GBP"},
+	{"locale", "en-GB"},
+	{"language", "en"},
+	{"colour", "#336699"},
+	{"color", "#336699"},
+	{"uuid", "3fa85f64-5717-4562-b3fc-2c963f66afa6"},
+	{"date", sampleTime},
+	{"time", sampleTime},
+	{"name", "John Doe"},
+}
+
+// Samples plausible value of the scalar or enum type by the field name.
+func (e *executor) sample(def *ast.Definition, name string) interface{} {
+	if def.Kind == ast.Enum {
+		if len(def.EnumValues) == 0 {
+			return nil
+		}
+		return def.EnumValues[0].Name
+	}
+
+	lname := strings.ToLower(name)
+	switch def.Name {
+	case "ID":
+		e.id++
+		return strconv.Itoa(e.id)
+	case "Int":
+		// matched by the last word, e.g. pageSize is a size, not a page
+		switch lastWord(name) {
+		case "page":
+			return 1
+		case "age":
+			return 30
+		case "year":
+			return 2020
+		case "count", "total", "size", "limit", "pages":
+			return 10
+		}
+		return 42
+	case "Float":
+		switch {
+		case strings.Contains(lname, "price"), strings.Contains(lname, "amount"):
+			return 9.99
+		case strings.HasPrefix(lname, "lat"):
+			return 51.5237
+		case strings.HasPrefix(lname, "lng"), strings.HasPrefix(lname, "lon"):
+			return -0.1585
+		case strings.Contains(lname, "rating"), strings.Contains(lname, "score"):
+			return 4.5
+		}
+		return 1.5
+	case "Boolean":
+		return true
+	case "String":
+		if strings.HasSuffix(name, "At") {
+			// e.g. createdAt
+			return sampleTime
+		}
+		for _, s := range sampleStrings {
+			if strings.Contains(lname, s.part) {
+				return s.value
+			}
+		}
+		return "Lorem ipsum"
+	}
+
+	// custom scalars
+	lname = strings.ToLower(def.Name)
+	switch {
+	case strings.Contains(lname, "date"), strings.Contains(lname, "time"):
+		return sampleTime
+	case strings.Contains(lname, "url"), strings.Contains(lname, "uri"):
+		return "https://example.com"
+	case strings.Contains(lname, "json"), strings.Contains(lname, "map"):
+		return map[string]interface{}{}
+	}
+	return "Lorem ipsum"
+}
+
+// Returns the last word of camelCase or snake_case name in lower case.
+func lastWord(name string) string {
+	i := strings.LastIndexAny(name, "_-")
+	name = name[i+1:]
+	for j := len(name) - 1; j > 0; j-- {
+		if name[j] >= 'A' && name[j] <= 'Z' && name[j-1] >= 'a' && name[j-1] <= 'z' {
+			name = name[j:]
+			break
+		}
+	}
+	return strings.ToLower(name)
+}
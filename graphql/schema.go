@@ -0,0 +1,73 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/vektah/gqlparser"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/gqlerror"
+)
+
+// Request is GraphQL query sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Error is reported in the response for invalid requests and fields, which
+// failed to resolve.
+type Error struct {
+	Message   string              `json:"message"`
+	Locations []gqlerror.Location `json:"locations,omitempty"`
+	Path      []interface{}       `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// LoadSchema parses schema in SDL format.
+func LoadSchema(name, sdl string) (*ast.Schema, error) {
+	s, err := gqlparser.LoadSchema(&ast.Source{Name: name, Input: sdl})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadRequest reads GraphQL request from query parameters of GET request, or
+// from JSON or "application/graphql" body.
+func ReadRequest(r *http.Request, maxSize int64) (*Request, error) {
+	req := &Request{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return nil, errors.New("variables must be a JSON object")
+			}
+		}
+		return req, nil
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize))
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/graphql" {
+		req.Query = string(b)
+		return req, nil
+	}
+	if err = json.Unmarshal(b, req); err != nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	return req, nil
+}
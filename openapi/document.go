@@ -0,0 +1,629 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const Version = "3.0.0"
+
+const maxRefDepth = 32
+
+var Methods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+
+	// Swagger 2.0
+	Swagger     string                `json:"swagger,omitempty"`
+	Host        string                `json:"host,omitempty"`
+	BasePath    string                `json:"basePath,omitempty"`
+	Schemes     []string              `json:"schemes,omitempty"`
+	Consumes    []string              `json:"consumes,omitempty"`
+	Produces    []string              `json:"produces,omitempty"`
+	Definitions map[string]*Schema    `json:"definitions,omitempty"`
+	Parameters  map[string]*Parameter `json:"parameters,omitempty"`
+	Responses   map[string]*Response  `json:"responses,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `json:"schemas,omitempty"`
+	Parameters    map[string]*Parameter   `json:"parameters,omitempty"`
+	RequestBodies map[string]*RequestBody `json:"requestBodies,omitempty"`
+	Responses     map[string]*Response    `json:"responses,omitempty"`
+}
+
+type PathItem struct {
+	Summary    string       `json:"summary,omitempty"`
+	Parameters []*Parameter `json:"parameters,omitempty"`
+	Get        *Operation   `json:"get,omitempty"`
+	Put        *Operation   `json:"put,omitempty"`
+	Post       *Operation   `json:"post,omitempty"`
+	Delete     *Operation   `json:"delete,omitempty"`
+	Options    *Operation   `json:"options,omitempty"`
+	Head       *Operation   `json:"head,omitempty"`
+	Patch      *Operation   `json:"patch,omitempty"`
+	Trace      *Operation   `json:"trace,omitempty"`
+}
+
+func (pi *PathItem) operation(method string) **Operation {
+	switch method {
+	case "GET":
+		return &pi.Get
+	case "PUT":
+		return &pi.Put
+	case "POST":
+		return &pi.Post
+	case "DELETE":
+		return &pi.Delete
+	case "OPTIONS":
+		return &pi.Options
+	case "HEAD":
+		return &pi.Head
+	case "PATCH":
+		return &pi.Patch
+	case "TRACE":
+		return &pi.Trace
+	}
+	return nil
+}
+
+// Operation returns path operation for the method or nil.
+func (pi *PathItem) Operation(method string) *Operation {
+	if op := pi.operation(strings.ToUpper(method)); op != nil {
+		return *op
+	}
+	return nil
+}
+
+func (pi *PathItem) SetOperation(method string, op *Operation) {
+	if ptr := pi.operation(strings.ToUpper(method)); ptr != nil {
+		*ptr = op
+	}
+}
+
+type Operation struct {
+	OperationId string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+
+	// Swagger 2.0
+	Consumes []string `json:"consumes,omitempty"`
+	Produces []string `json:"produces,omitempty"`
+}
+
+type Parameter struct {
+	Ref         string      `json:"$ref,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	In          string      `json:"in,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *Schema     `json:"schema,omitempty"`
+	Example     interface{} `json:"example,omitempty"`
+
+	// Swagger 2.0
+	Type    string        `json:"type,omitempty"`
+	Format  string        `json:"format,omitempty"`
+	Items   *Schema       `json:"items,omitempty"`
+	Enum    []interface{} `json:"enum,omitempty"`
+	Default interface{}   `json:"default,omitempty"`
+}
+
+type RequestBody struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+
+	// Swagger 2.0
+	Schema   *Schema                `json:"schema,omitempty"`
+	Examples map[string]interface{} `json:"examples,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+
+	// Swagger 2.0
+	Type   string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+type MediaType struct {
+	Schema   *Schema             `json:"schema,omitempty"`
+	Example  interface{}         `json:"example,omitempty"`
+	Examples map[string]*Example `json:"examples,omitempty"`
+}
+
+type Example struct {
+	Summary string      `json:"summary,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	never bool // boolean "false" schema
+}
+
+// UnmarshalJSON supports boolean schemas, e.g. "additionalProperties: false",
+// and type arrays of OpenAPI 3.1, e.g. "type: [string, null]".
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{never: true}
+		return nil
+	}
+
+	type schema Schema
+	var v struct {
+		*schema
+		Type interface{} `json:"type"`
+	}
+	v.schema = (*schema)(s)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.Type.(type) {
+	case string:
+		s.Type = t
+	case []interface{}:
+		for _, t := range t {
+			if t == "null" {
+				s.Nullable = true
+			} else if t, ok := t.(string); ok {
+				s.Type = t
+			}
+		}
+	}
+	return nil
+}
+
+// Load parses OpenAPI 3 or Swagger 2.0 document in JSON or YAML format.
+// Swagger documents are converted to OpenAPI 3.
+func Load(data []byte) (*Document, error) {
+	data, err := ToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var version struct {
+		OpenAPI string `json:"openapi"`
+		Swagger string `json:"swagger"`
+	}
+	if err = json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(version.OpenAPI, "3."):
+	case version.Swagger == "2.0":
+	default:
+		return nil, errors.New("openapi: unsupported document version")
+	}
+
+	d := &Document{}
+	if err = json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	if d.Paths == nil {
+		return nil, errors.New("openapi: no paths found")
+	}
+	if d.Swagger != "" {
+		d.convert()
+	}
+	return d, nil
+}
+
+// ToJSON converts YAML document to JSON. JSON documents are returned as is.
+func ToJSON(data []byte) ([]byte, error) {
+	if json.Valid(data) {
+		return data, nil
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := yamlToJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func yamlToJSON(v interface{}) (interface{}, error) {
+	var err error
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			if m[fmt.Sprint(k)], err = yamlToJSON(v); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, v := range vv {
+			if vv[i], err = yamlToJSON(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Converts Swagger 2.0 document to OpenAPI 3.
+func (d *Document) convert() {
+	d.OpenAPI, d.Swagger = Version, ""
+	if d.Host != "" || d.BasePath != "" {
+		scheme := "https"
+		if len(d.Schemes) > 0 {
+			scheme = d.Schemes[0]
+		}
+		u := d.BasePath
+		if d.Host != "" {
+			u = scheme + "://" + d.Host + d.BasePath
+		}
+		d.Servers = []Server{{URL: u}}
+	}
+
+	d.Components = &Components{
+		Schemas:    d.Definitions,
+		Parameters: d.Parameters,
+		Responses:  d.Responses,
+	}
+	d.convertRefs()
+	for _, r := range d.Components.Responses {
+		d.convertResponse(r, d.Produces)
+	}
+
+	for _, pi := range d.Paths {
+		for _, method := range Methods {
+			op := pi.Operation(method)
+			if op == nil {
+				continue
+			}
+			consumes, produces := d.Consumes, d.Produces
+			if op.Consumes != nil {
+				consumes = op.Consumes
+			}
+			if op.Produces != nil {
+				produces = op.Produces
+			}
+
+			var params []*Parameter
+			for _, p := range append(append([]*Parameter(nil), pi.Parameters...), op.Parameters...) {
+				if p = d.Parameter(p); p == nil {
+					continue
+				}
+				switch p.In {
+				case "body":
+					op.RequestBody = &RequestBody{Description: p.Description, Required: p.Required, Content: map[string]*MediaType{}}
+					for _, mediaType := range mediaTypes(consumes) {
+						op.RequestBody.Content[mediaType] = &MediaType{Schema: p.Schema}
+					}
+				case "formData":
+					if op.RequestBody == nil {
+						op.RequestBody = &RequestBody{Content: map[string]*MediaType{}}
+					}
+					mediaType := "application/x-www-form-urlencoded"
+					for _, v := range consumes {
+						if v == "multipart/form-data" {
+							mediaType = v
+						}
+					}
+					mt, ok := op.RequestBody.Content[mediaType]
+					if !ok {
+						mt = &MediaType{Schema: &Schema{Type: "object", Properties: map[string]*Schema{}}}
+						op.RequestBody.Content[mediaType] = mt
+					}
+					mt.Schema.Properties[p.Name] = p.schema()
+					if p.Required {
+						mt.Schema.Required = append(mt.Schema.Required, p.Name)
+					}
+				default:
+					cp := *p
+					cp.Ref, cp.Schema = "", p.schema()
+					cp.Type, cp.Format, cp.Items, cp.Enum, cp.Default = "", "", nil, nil, nil
+					params = append(params, &cp)
+				}
+			}
+			op.Parameters, op.Consumes, op.Produces = params, nil, nil
+
+			for _, r := range op.Responses {
+				d.convertResponse(r, produces)
+			}
+		}
+		pi.Parameters = nil
+	}
+
+	d.Host, d.BasePath, d.Schemes, d.Consumes, d.Produces = "", "", nil, nil, nil
+	d.Definitions, d.Parameters, d.Responses = nil, nil, nil
+}
+
+// Moves references of the document to OpenAPI 3 components.
+func (d *Document) convertRefs() {
+	for _, s := range d.Components.Schemas {
+		convertSchemaRefs(s)
+	}
+	for _, p := range d.Components.Parameters {
+		convertParameterRefs(p)
+	}
+	for _, r := range d.Components.Responses {
+		convertResponseRefs(r)
+	}
+	for _, pi := range d.Paths {
+		for _, p := range pi.Parameters {
+			convertParameterRefs(p)
+		}
+		for _, method := range Methods {
+			if op := pi.Operation(method); op != nil {
+				for _, p := range op.Parameters {
+					convertParameterRefs(p)
+				}
+				for _, r := range op.Responses {
+					convertResponseRefs(r)
+				}
+			}
+		}
+	}
+}
+
+func convertParameterRefs(p *Parameter) {
+	if p != nil {
+		p.Ref = convertRef(p.Ref)
+		convertSchemaRefs(p.Schema)
+		convertSchemaRefs(p.Items)
+	}
+}
+
+func convertResponseRefs(r *Response) {
+	if r != nil {
+		r.Ref = convertRef(r.Ref)
+		convertSchemaRefs(r.Schema)
+	}
+}
+
+func convertSchemaRefs(s *Schema) {
+	if s == nil {
+		return
+	}
+	s.Ref = convertRef(s.Ref)
+	for _, ps := range s.Properties {
+		convertSchemaRefs(ps)
+	}
+	convertSchemaRefs(s.AdditionalProperties)
+	convertSchemaRefs(s.Items)
+	for _, ss := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf} {
+		for _, cs := range ss {
+			convertSchemaRefs(cs)
+		}
+	}
+}
+
+func convertRef(ref string) string {
+	for from, to := range map[string]string{
+		"#/definitions/": "#/components/schemas/",
+		"#/parameters/":  "#/components/parameters/",
+		"#/responses/":   "#/components/responses/",
+	} {
+		if strings.HasPrefix(ref, from) {
+			return to + strings.TrimPrefix(ref, from)
+		}
+	}
+	return ref
+}
+
+func (d *Document) convertResponse(r *Response, produces []string) {
+	if r == nil || r.Ref != "" {
+		return
+	}
+	if r.Schema != nil || len(r.Examples) > 0 {
+		r.Content = make(map[string]*MediaType)
+		for _, mediaType := range mediaTypes(produces) {
+			r.Content[mediaType] = &MediaType{Schema: r.Schema, Example: r.Examples[mediaType]}
+		}
+	}
+	for _, h := range r.Headers {
+		if h.Schema == nil {
+			h.Schema = &Schema{Type: h.Type, Format: h.Format}
+		}
+		h.Type, h.Format = "", ""
+	}
+	r.Schema, r.Examples = nil, nil
+}
+
+func (p *Parameter) schema() *Schema {
+	if p.Schema != nil {
+		return p.Schema
+	}
+	return &Schema{Type: p.Type, Format: p.Format, Items: p.Items, Enum: p.Enum, Default: p.Default}
+}
+
+func mediaTypes(v []string) []string {
+	if len(v) == 0 {
+		return []string{"application/json"}
+	}
+	return v
+}
+
+func (d *Document) ref(ref, kind string) string {
+	prefix := "#/components/" + kind + "/"
+	if d.Components == nil || !strings.HasPrefix(ref, prefix) {
+		return ""
+	}
+	name := strings.TrimPrefix(ref, prefix)
+	return strings.Replace(strings.Replace(name, "~1", "/", -1), "~0", "~", -1)
+}
+
+// Schema resolves schema reference.
+func (d *Document) Schema(s *Schema) *Schema {
+	for i := 0; s != nil && s.Ref != ""; i++ {
+		if i == maxRefDepth {
+			return nil
+		}
+		name := d.ref(s.Ref, "schemas")
+		if name == "" {
+			return nil
+		}
+		s = d.Components.Schemas[name]
+	}
+	return s
+}
+
+// Parameter resolves parameter reference.
+func (d *Document) Parameter(p *Parameter) *Parameter {
+	for i := 0; p != nil && p.Ref != ""; i++ {
+		if i == maxRefDepth {
+			return nil
+		}
+		name := d.ref(p.Ref, "parameters")
+		if name == "" {
+			return nil
+		}
+		p = d.Components.Parameters[name]
+	}
+	return p
+}
+
+// RequestBody resolves request body reference.
+func (d *Document) RequestBody(b *RequestBody) *RequestBody {
+	for i := 0; b != nil && b.Ref != ""; i++ {
+		if i == maxRefDepth {
+			return nil
+		}
+		name := d.ref(b.Ref, "requestBodies")
+		if name == "" {
+			return nil
+		}
+		b = d.Components.RequestBodies[name]
+	}
+	return b
+}
+
+// Response resolves response reference.
+func (d *Document) Response(r *Response) *Response {
+	for i := 0; r != nil && r.Ref != ""; i++ {
+		if i == maxRefDepth {
+			return nil
+		}
+		name := d.ref(r.Ref, "responses")
+		if name == "" {
+			return nil
+		}
+		r = d.Components.Responses[name]
+	}
+	return r
+}
+
+// ServerPath returns path prefix of the first server.
+func (d *Document) ServerPath() string {
+	if len(d.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(d.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// OperationParameters returns resolved path and operation parameters, where
+// operation parameters override path ones.
+func (d *Document) OperationParameters(pi *PathItem, op *Operation) []*Parameter {
+	var params []*Parameter
+	index := make(map[string]int)
+	for _, p := range append(append([]*Parameter(nil), pi.Parameters...), op.Parameters...) {
+		if p = d.Parameter(p); p == nil {
+			continue
+		}
+		key := p.In + ":" + p.Name
+		if i, ok := index[key]; ok {
+			params[i] = p
+			continue
+		}
+		index[key] = len(params)
+		params = append(params, p)
+	}
+	return params
+}
+
+// SortedPaths returns document paths in alphabetical order.
+func (d *Document) SortedPaths() []string {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ToYAML encodes value to YAML with its JSON field names.
+func ToYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var vv interface{}
+	if err = json.Unmarshal(data, &vv); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(vv)
+}
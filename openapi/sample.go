@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum depth of nested schemas, which limits recursive definitions.
+const maxSampleDepth = 8
+
+// Limits sizes of the samples generated for large minItems and minLength
+// values, so such samples do not conform to the schema.
+const (
+	sampleMaxItems  = 16
+	sampleMaxLength = 1024
+)
+
+// Sample generates example value that conforms to the schema.
+func (d *Document) Sample(s *Schema) interface{} {
+	return d.sample(s, 0)
+}
+
+func (d *Document) sample(s *Schema, depth int) interface{} {
+	if s = d.Schema(s); s == nil || depth > maxSampleDepth {
+		return nil
+	}
+	switch {
+	case s.Example != nil:
+		return s.Example
+	case s.Default != nil:
+		return s.Default
+	case len(s.Enum) > 0:
+		return s.Enum[0]
+	case len(s.AllOf) > 0:
+		obj := make(map[string]interface{})
+		for _, ss := range s.AllOf {
+			v := d.sample(ss, depth+1)
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			for k, v := range m {
+				obj[k] = v
+			}
+		}
+		return obj
+	case len(s.OneOf) > 0:
+		return d.sample(s.OneOf[0], depth+1)
+	case len(s.AnyOf) > 0:
+		return d.sample(s.AnyOf[0], depth+1)
+	}
+
+	switch s.Type {
+	case "string":
+		return sampleString(s)
+	case "integer":
+		if s.Minimum != nil {
+			return int64(*s.Minimum)
+		}
+		return 1
+	case "number":
+		if s.Minimum != nil {
+			return *s.Minimum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		n := 1
+		if s.MinItems != nil && *s.MinItems > n {
+			n = *s.MinItems
+		}
+		if n > sampleMaxItems {
+			n = sampleMaxItems
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			arr[i] = d.sample(s.Items, depth+1)
+		}
+		return arr
+	}
+
+	obj := make(map[string]interface{})
+	for name, ps := range s.Properties {
+		obj[name] = d.sample(ps, depth+1)
+	}
+	if len(obj) == 0 && s.AdditionalProperties != nil {
+		obj["key"] = d.sample(s.AdditionalProperties, depth+1)
+	}
+	return obj
+}
+
+func sampleString(s *Schema) string {
+	var v string
+	switch s.Format {
+	case "date":
+		v = "2018-01-01"
+	case "date-time":
+		v = "2018-01-01T00:00:00Z"
+	case "email":
+		v = "user@example.com"
+	case "uuid":
+		v = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "uri", "url":
+		v = "https://example.com"
+	case "hostname":
+		v = "example.com"
+	case "ipv4":
+		v = "127.0.0.1"
+	case "ipv6":
+		v = "::1"
+	case "byte":
+		v = "c3RyaW5n"
+	default:
+		v = "string"
+	}
+	if s.MinLength != nil && len(v) < *s.MinLength {
+		n := *s.MinLength
+		if n > sampleMaxLength {
+			n = sampleMaxLength
+		}
+		if len(v) < n {
+			v += strings.Repeat("x", n-len(v))
+		}
+	}
+	if s.MaxLength != nil && len(v) > *s.MaxLength {
+		v = v[:*s.MaxLength]
+	}
+	return v
+}
+
+// IsJSON reports whether media type holds JSON document.
+func IsJSON(mediaType string) bool {
+	if mt, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = mt
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Example returns status code, response and its media type, which document
+// the successful outcome of the operation. Media type is empty if response
+// has no content.
+func (d *Document) Example(op *Operation) (int, *Response, string) {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	code := ""
+	for _, c := range codes {
+		if strings.HasPrefix(c, "2") {
+			code = c
+			break
+		}
+	}
+	if code == "" {
+		if _, ok := op.Responses["default"]; ok {
+			code = "default"
+		} else if len(codes) > 0 {
+			code = codes[0]
+		}
+	}
+
+	status, err := strconv.Atoi(strings.Replace(strings.ToUpper(code), "XX", "00", 1))
+	if err != nil || status < 100 || status > 999 {
+		status = 200
+	}
+	r := d.Response(op.Responses[code])
+	if r == nil || len(r.Content) == 0 {
+		return status, r, ""
+	}
+
+	mediaTypes := make([]string, 0, len(r.Content))
+	for mediaType := range r.Content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		if IsJSON(mediaType) {
+			return status, r, mediaType
+		}
+	}
+	return status, r, mediaTypes[0]
+}
+
+// MediaExample returns documented or generated example value of media type.
+func (d *Document) MediaExample(mt *MediaType) interface{} {
+	if mt == nil {
+		return nil
+	}
+	if mt.Example != nil {
+		return mt.Example
+	}
+	if len(mt.Examples) > 0 {
+		names := make([]string, 0, len(mt.Examples))
+		for name := range mt.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if ex := mt.Examples[names[0]]; ex != nil && ex.Value != nil {
+			return ex.Value
+		}
+	}
+	return d.Sample(mt.Schema)
+}
+
+// SchemaOf infers schema of decoded JSON value.
+func SchemaOf(v interface{}) *Schema {
+	switch vv := v.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case float64:
+		if vv == float64(int64(vv)) {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case string:
+		return &Schema{Type: "string"}
+	case []interface{}:
+		s := &Schema{Type: "array", Items: &Schema{}}
+		if len(vv) > 0 {
+			s.Items = SchemaOf(vv[0])
+		}
+		return s
+	case map[string]interface{}:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema, len(vv))}
+		for k, v := range vv {
+			s.Properties[k] = SchemaOf(v)
+		}
+		return s
+	}
+	return &Schema{}
+}
@@ -0,0 +1,509 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of violations reported for a single request or response.
+const maxViolations = 16
+
+// Validator checks requests and responses against operations of the document.
+type Validator struct {
+	doc        *Document
+	operations []validatorOperation
+	patterns   map[string]*regexp.Regexp
+}
+
+type validatorOperation struct {
+	re     *regexp.Regexp
+	names  []string
+	params int
+	method string
+	path   string
+	pi     *PathItem
+	op     *Operation
+}
+
+// NewValidator prepares validator of the document. Error reports schema
+// patterns, which cannot be compiled, e.g. with lookarounds, and which are not
+// checked by the returned validator.
+func NewValidator(d *Document) (*Validator, error) {
+	v := &Validator{doc: d, patterns: make(map[string]*regexp.Regexp)}
+	errs := v.compilePatterns()
+	basePath := regexp.QuoteMeta(d.ServerPath())
+	for path, pi := range d.Paths {
+		if pi == nil {
+			continue
+		}
+
+		var names []string
+		expr := specPathParam.ReplaceAllStringFunc(regexp.QuoteMeta(path), func(param string) string {
+			names = append(names, strings.Replace(param[2:len(param)-2], `\`, "", -1))
+			return "([^/]+)"
+		})
+		re, err := regexp.Compile("^" + basePath + expr + "$")
+		if err != nil {
+			continue
+		}
+
+		for _, method := range Methods {
+			if op := pi.Operation(method); op != nil {
+				v.operations = append(v.operations, validatorOperation{re, names, len(names), method, path, pi, op})
+			}
+		}
+	}
+
+	// literal paths win over templated ones
+	sort.SliceStable(v.operations, func(i, j int) bool {
+		if v.operations[i].params != v.operations[j].params {
+			return v.operations[i].params < v.operations[j].params
+		}
+		return v.operations[i].path < v.operations[j].path
+	})
+	if len(errs) > 0 {
+		return v, errors.New(strings.Join(errs, "; "))
+	}
+	return v, nil
+}
+
+// Compiles patterns of all schemas of the document, so they are not compiled
+// on every request.
+func (v *Validator) compilePatterns() []string {
+	var errs []string
+	seen := make(map[*Schema]bool)
+	var walk func(s *Schema)
+	walk = func(s *Schema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		if _, ok := v.patterns[s.Pattern]; s.Pattern != "" && !ok {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf(`pattern "%s": %v`, s.Pattern, err))
+			}
+			v.patterns[s.Pattern] = re
+		}
+		for _, ps := range s.Properties {
+			walk(ps)
+		}
+		walk(s.AdditionalProperties)
+		walk(s.Items)
+		for _, ss := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf} {
+			for _, s := range ss {
+				walk(s)
+			}
+		}
+	}
+	walkParameters := func(ps []*Parameter) {
+		for _, p := range ps {
+			if p != nil {
+				walk(p.Schema)
+			}
+		}
+	}
+	walkContent := func(content map[string]*MediaType) {
+		for _, mt := range content {
+			if mt != nil {
+				walk(mt.Schema)
+			}
+		}
+	}
+	walkResponse := func(r *Response) {
+		if r == nil {
+			return
+		}
+		for _, h := range r.Headers {
+			if h != nil {
+				walk(h.Schema)
+			}
+		}
+		walkContent(r.Content)
+	}
+
+	if c := v.doc.Components; c != nil {
+		for _, s := range c.Schemas {
+			walk(s)
+		}
+		for _, p := range c.Parameters {
+			walkParameters([]*Parameter{p})
+		}
+		for _, rb := range c.RequestBodies {
+			if rb != nil {
+				walkContent(rb.Content)
+			}
+		}
+		for _, r := range c.Responses {
+			walkResponse(r)
+		}
+	}
+	for _, pi := range v.doc.Paths {
+		if pi == nil {
+			continue
+		}
+		walkParameters(pi.Parameters)
+		for _, method := range Methods {
+			op := pi.Operation(method)
+			if op == nil {
+				continue
+			}
+			walkParameters(op.Parameters)
+			if op.RequestBody != nil {
+				walkContent(op.RequestBody.Content)
+			}
+			for _, r := range op.Responses {
+				walkResponse(r)
+			}
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+var specPathParam = regexp.MustCompile(`\\\{[^}]*\\\}`)
+
+func (v *Validator) match(req *http.Request) (*validatorOperation, map[string]string) {
+	for i := range v.operations {
+		vo := &v.operations[i]
+		if vo.method != req.Method {
+			continue
+		}
+		pv := vo.re.FindStringSubmatch(req.URL.Path)
+		if pv == nil {
+			continue
+		}
+		params := make(map[string]string, len(vo.names))
+		for i, name := range vo.names {
+			params[name] = pv[i+1]
+		}
+		return vo, params
+	}
+	return nil, nil
+}
+
+// ValidateRequest returns violations of the request, which body is given.
+func (v *Validator) ValidateRequest(req *http.Request, body []byte) []string {
+	vo, pathParams := v.match(req)
+	if vo == nil {
+		return []string{fmt.Sprintf("request: operation %s %s is not documented", req.Method, req.URL.Path)}
+	}
+
+	vs := &violations{}
+	query := req.URL.Query()
+	for _, p := range v.doc.OperationParameters(vo.pi, vo.op) {
+		var values []string
+		switch p.In {
+		case "path":
+			if pv, ok := pathParams[p.Name]; ok {
+				values = []string{pv}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = req.Header[textproto.CanonicalMIMEHeaderKey(p.Name)]
+		case "cookie":
+			if c, err := req.Cookie(p.Name); err == nil {
+				values = []string{c.Value}
+			}
+		default:
+			continue
+		}
+
+		at := fmt.Sprintf(`request: %s parameter "%s"`, p.In, p.Name)
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				vs.add(at, "is required")
+			}
+			continue
+		}
+		v.validateParameter(vs, at, p, values)
+	}
+
+	rb := v.doc.RequestBody(vo.op.RequestBody)
+	if rb == nil {
+		return vs.list
+	}
+	if len(body) == 0 {
+		if rb.Required {
+			vs.add("request: body", "is required")
+		}
+		return vs.list
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	mediaType, mt := matchMediaType(rb.Content, contentType)
+	if mediaType == "" {
+		vs.add("request: content type", fmt.Sprintf(`"%s" is not documented`, contentType))
+		return vs.list
+	}
+	if mt != nil && mt.Schema != nil && IsJSON(contentType) {
+		v.validateJSON(vs, "request: body", mt.Schema, body)
+	}
+	return vs.list
+}
+
+// ValidateResponse returns violations of the response to the request.
+func (v *Validator) ValidateResponse(req *http.Request, status int, header http.Header, body []byte) []string {
+	vo, _ := v.match(req)
+	if vo == nil {
+		return nil
+	}
+
+	code := strconv.Itoa(status)
+	r, ok := vo.op.Responses[code]
+	if !ok {
+		r, ok = vo.op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		r, ok = vo.op.Responses["default"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("response: status %d is not documented", status)}
+	}
+
+	vs := &violations{}
+	if r = v.doc.Response(r); r == nil {
+		return nil
+	}
+	for name, h := range r.Headers {
+		if h.Required && header.Get(name) == "" && !strings.EqualFold(name, "Content-Type") {
+			vs.add(fmt.Sprintf(`response: header "%s"`, name), "is required")
+		}
+	}
+
+	if len(r.Content) == 0 {
+		return vs.list
+	}
+	contentType := header.Get("Content-Type")
+	mediaType, mt := matchMediaType(r.Content, contentType)
+	if mediaType == "" {
+		vs.add("response: content type", fmt.Sprintf(`"%s" is not documented`, contentType))
+		return vs.list
+	}
+	if mt != nil && mt.Schema != nil && IsJSON(contentType) {
+		v.validateJSON(vs, "response: body", mt.Schema, body)
+	}
+	return vs.list
+}
+
+// Finds documented media type that matches content type, including ranges,
+// e.g. "application/*".
+func matchMediaType(content map[string]*MediaType, contentType string) (string, *MediaType) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	for _, key := range []string{mediaType, strings.SplitN(mediaType, "/", 2)[0] + "/*", "*/*"} {
+		for k, mt := range content {
+			if kt, _, err := mime.ParseMediaType(k); err == nil && strings.EqualFold(kt, key) {
+				return k, mt
+			}
+		}
+	}
+	return "", nil
+}
+
+type violations struct {
+	list []string
+}
+
+func (vs *violations) add(at, msg string) {
+	if len(vs.list) < maxViolations {
+		vs.list = append(vs.list, at+" "+msg)
+	}
+}
+
+func (v *Validator) validateParameter(vs *violations, at string, p *Parameter, values []string) {
+	s := v.doc.Schema(p.Schema)
+	if s == nil {
+		return
+	}
+	if s.Type == "array" {
+		if p.In != "query" && len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		arr := make([]interface{}, len(values))
+		for i, value := range values {
+			arr[i] = v.parseValue(v.doc.Schema(s.Items), value)
+		}
+		v.validateValue(vs, at, s, arr, 0)
+		return
+	}
+	v.validateValue(vs, at, s, v.parseValue(s, values[0]), 0)
+}
+
+// Converts parameter string to the value of the schema type.
+func (v *Validator) parseValue(s *Schema, value string) interface{} {
+	if s == nil {
+		return value
+	}
+	switch s.Type {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func (v *Validator) validateJSON(vs *violations, at string, s *Schema, body []byte) {
+	var val interface{}
+	if err := json.Unmarshal(body, &val); err != nil {
+		vs.add(at, "is not valid JSON")
+		return
+	}
+	v.validateValue(vs, at, s, val, 0)
+}
+
+func (v *Validator) validateValue(vs *violations, at string, s *Schema, val interface{}, depth int) {
+	if s = v.doc.Schema(s); s == nil || depth > maxRefDepth {
+		return
+	}
+	if s.never {
+		vs.add(at, "is not allowed")
+		return
+	}
+	if val == nil {
+		if !s.Nullable && s.Type != "" {
+			vs.add(at, "must not be null")
+		}
+		return
+	}
+
+	for _, ss := range s.AllOf {
+		v.validateValue(vs, at, ss, val, depth+1)
+	}
+	if len(s.OneOf) > 0 && v.countMatches(s.OneOf, val, depth, 2) != 1 {
+		vs.add(at, "must match exactly one of schemas")
+	}
+	if len(s.AnyOf) > 0 && v.countMatches(s.AnyOf, val, depth, 1) == 0 {
+		vs.add(at, "must match any of schemas")
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonEqual(e, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			vs.add(at, "must be one of enumerated values")
+		}
+	}
+
+	// keywords are checked independently, and only if the type matches
+	switch vv := val.(type) {
+	case bool:
+		if s.Type != "" && s.Type != "boolean" {
+			vs.add(at, "must be "+s.Type)
+		}
+	case float64:
+		if s.Type != "" && s.Type != "integer" && s.Type != "number" {
+			vs.add(at, "must be "+s.Type)
+			return
+		}
+		if s.Type == "integer" && vv != float64(int64(vv)) {
+			vs.add(at, "must be integer")
+		}
+		if s.Minimum != nil && vv < *s.Minimum {
+			vs.add(at, fmt.Sprintf("must be greater than or equal to %v", *s.Minimum))
+		}
+		if s.Maximum != nil && vv > *s.Maximum {
+			vs.add(at, fmt.Sprintf("must be less than or equal to %v", *s.Maximum))
+		}
+	case string:
+		if s.Type != "" && s.Type != "string" {
+			vs.add(at, "must be "+s.Type)
+			return
+		}
+		n := len([]rune(vv))
+		if s.MinLength != nil && n < *s.MinLength {
+			vs.add(at, fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			vs.add(at, fmt.Sprintf("must be at most %d characters long", *s.MaxLength))
+		}
+		// patterns, which cannot be compiled, are not checked
+		if re := v.patterns[s.Pattern]; s.Pattern != "" && re != nil && !re.MatchString(vv) {
+			vs.add(at, fmt.Sprintf(`must match pattern "%s"`, s.Pattern))
+		}
+	case []interface{}:
+		if s.Type != "" && s.Type != "array" {
+			vs.add(at, "must be "+s.Type)
+			return
+		}
+		if s.MinItems != nil && len(vv) < *s.MinItems {
+			vs.add(at, fmt.Sprintf("must contain at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(vv) > *s.MaxItems {
+			vs.add(at, fmt.Sprintf("must contain at most %d items", *s.MaxItems))
+		}
+		for i, item := range vv {
+			v.validateValue(vs, fmt.Sprintf("%s[%d]", at, i), s.Items, item, depth+1)
+		}
+	case map[string]interface{}:
+		if s.Type != "" && s.Type != "object" {
+			vs.add(at, "must be "+s.Type)
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := vv[name]; !ok {
+				vs.add(fmt.Sprintf(`%s property "%s"`, at, name), "is required")
+			}
+		}
+		names := make([]string, 0, len(vv))
+		for name := range vv {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pat := fmt.Sprintf(`%s property "%s"`, at, name)
+			if ps, ok := s.Properties[name]; ok {
+				v.validateValue(vs, pat, ps, vv[name], depth+1)
+			} else if s.AdditionalProperties != nil {
+				v.validateValue(vs, pat, s.AdditionalProperties, vv[name], depth+1)
+			}
+		}
+	}
+}
+
+// Counts schemas matching the value, but stops when limit is reached.
+func (v *Validator) countMatches(ss []*Schema, val interface{}, depth, limit int) int {
+	n := 0
+	for _, s := range ss {
+		vs := &violations{}
+		if v.validateValue(vs, "", s, val, depth+1); len(vs.list) == 0 {
+			if n++; n == limit {
+				break
+			}
+		}
+	}
+	return n
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,207 @@
+package adapter
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	_ "crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/lokhman/yams/yams"
+)
+
+// Limits secure random bytes, which are generated by the script at once.
+const cryptoMaxRandom = 1 << 16
+
+var cryptoHashes = map[string]crypto.Hash{
+	"md5":    crypto.MD5,
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+func cryptoHash(name string) (crypto.Hash, error) {
+	if h, ok := cryptoHashes[name]; ok {
+		return h, nil
+	}
+	return 0, fmt.Errorf(`unsupported hash "%s"`, name)
+}
+
+func cryptoDigest(h crypto.Hash, data []byte) []byte {
+	hh := h.New()
+	hh.Write(data)
+	return hh.Sum(nil)
+}
+
+func cryptoHMAC(h crypto.Hash, key, data []byte) []byte {
+	mac := hmac.New(h.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func cryptoRandom(n int) ([]byte, error) {
+	if n < 0 || n > cryptoMaxRandom {
+		return nil, fmt.Errorf("size must be between 0 and %d", cryptoMaxRandom)
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Binary results are encoded with "hex" (default), "base64" or "raw".
+func cryptoEncode(b []byte, enc string) (string, error) {
+	switch enc {
+	case "", "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "raw":
+		return string(b), nil
+	}
+	return "", fmt.Errorf(`unsupported encoding "%s"`, enc)
+}
+
+func cryptoDecode(s, enc string) ([]byte, error) {
+	switch enc {
+	case "", "hex":
+		return hex.DecodeString(s)
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	case "raw":
+		return []byte(s), nil
+	}
+	return nil, fmt.Errorf(`unsupported encoding "%s"`, enc)
+}
+
+// Encrypts data with AES-GCM, and prepends random nonce to the result.
+func cryptoEncrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := cryptoAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func cryptoDecrypt(key, data []byte) ([]byte, error) {
+	aead, err := cryptoAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func cryptoAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Loads PEM encoded key or certificate from the profile asset.
+func cryptoKey(pid int, path string) (interface{}, error) {
+	var data []byte
+	q := `SELECT data FROM assets WHERE profile_id = $1 AND path = $2`
+	if err := yams.DB.QueryRow(q, pid, path).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf(`asset "%s" not found`, path)
+		}
+		panic(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf(`no PEM data found in asset "%s"`, path)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf(`unsupported PEM block "%s" in asset "%s"`, block.Type, path)
+}
+
+// cryptoKeys caches keys loaded by the script run, keyed by asset path, so
+// repeated signing does not query and parse the asset again.
+type cryptoKeys map[string]interface{}
+
+func (ks *cryptoKeys) load(pid int, path string) (interface{}, error) {
+	if key, ok := (*ks)[path]; ok {
+		return key, nil
+	}
+	key, err := cryptoKey(pid, path)
+	if err != nil {
+		return nil, err
+	}
+	if *ks == nil {
+		*ks = make(cryptoKeys)
+	}
+	(*ks)[path] = key
+	return key, nil
+}
+
+// Signs data with RSA PKCS #1 v1.5 or ECDSA private key.
+func cryptoSign(key interface{}, h crypto.Hash, data []byte) ([]byte, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key.(crypto.Signer).Sign(rand.Reader, cryptoDigest(h, data), h)
+	}
+	return nil, errors.New("RSA or ECDSA private key is required")
+}
+
+// Verifies RSA PKCS #1 v1.5 or ECDSA signature with public key, which may be
+// derived from the private key.
+func cryptoVerify(key interface{}, h crypto.Hash, data, sig []byte) (bool, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	digest := cryptoDigest(h, data)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, h, digest, sig) == nil, nil
+	case *ecdsa.PublicKey:
+		var es struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) != 0 {
+			return false, nil
+		}
+		return ecdsa.Verify(k, digest, es.R, es.S), nil
+	}
+	return false, errors.New("RSA or ECDSA key is required")
+}
@@ -0,0 +1,181 @@
+package adapter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/lokhman/yams-lua"
+	"github.com/lokhman/yams/graphql"
+	"github.com/lokhman/yams/proxy/model"
+)
+
+const graphqlMaxRequestSize = 1 << 20
+
+// graphqlScript serves GraphQL requests with the schema of the profile. Script
+// returns table of resolvers by type and field names, e.g. Query.user, and
+// fields without resolvers are read from the parent values or sampled.
+type graphqlScript struct {
+	*luaScript
+	request *graphql.Request
+}
+
+func NewGraphQLScript(r *model.Route, rw http.ResponseWriter, req *http.Request, sid string) *graphqlScript {
+	s := &graphqlScript{luaScript: NewLuaScript(r, rw, req, sid)}
+	s.finish = s.done
+	return s
+}
+
+func (s *graphqlScript) Execute() error {
+	if s.route.Profile.GraphQLSchema() == nil {
+		return errors.New("yams: no GraphQL schema is configured for the profile")
+	}
+	var err error
+	if s.request, err = graphql.ReadRequest(s.req, graphqlMaxRequestSize); err != nil {
+		s.write(http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: err.Error()}}})
+		return nil
+	}
+	return s.luaScript.Execute()
+}
+
+func (s *graphqlScript) done(l *lua.LState, err error) error {
+	if err != nil {
+		if s.req.Context().Err() != nil {
+			return http.ErrAbortHandler
+		}
+		return err
+	}
+
+	var resolvers *lua.LTable
+	if top := l.GetTop(); top > 0 {
+		resolvers, _ = l.Get(top).(*lua.LTable)
+	}
+	res := graphql.Execute(l.Context(), s.route.Profile.GraphQLSchema(), s.request, func(typ, field string, args map[string]interface{}, parent interface{}) (interface{}, bool, error) {
+		if resolvers == nil {
+			return nil, false, nil
+		}
+		t, ok := resolvers.RawGetString(typ).(*lua.LTable)
+		if !ok {
+			return nil, false, nil
+		}
+		switch v := t.RawGetString(field).(type) {
+		case *lua.LNilType:
+			return nil, false, nil
+		case *lua.LFunction:
+			return s.call(l, v, args, parent)
+		default:
+			return luaGraphQLValue(v), true, nil
+		}
+	})
+	if s.req.Context().Err() != nil {
+		return http.ErrAbortHandler
+	}
+	if err = l.Context().Err(); err != nil {
+		// route timeout is reached
+		return err
+	}
+
+	status := s.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	s.write(status, res)
+	return nil
+}
+
+// Calls field resolver with arguments and parent value.
+func (s *graphqlScript) call(l *lua.LState, fn *lua.LFunction, args map[string]interface{}, parent interface{}) (interface{}, bool, error) {
+	lp, ok := parent.(luaGraphQLTable)
+	if !ok {
+		lp = luaGraphQLTable{l.NewTable()}
+	}
+	if err := l.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, luaGraphQLArg(l, args), lp.LTable); err != nil {
+		if !s.route.Profile.IsDebug {
+			return nil, true, errors.New("internal error")
+		}
+		return nil, true, err
+	}
+	v := l.Get(-1)
+	l.Pop(1)
+	return luaGraphQLValue(v), true, nil
+}
+
+func (s *graphqlScript) write(status int, res *graphql.Response) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+	s.rw.Header().Set("Content-Type", "application/json")
+	s.rw.WriteHeader(status)
+	s.rw.Write(b)
+}
+
+// luaGraphQLTable exposes Lua table to the executor as object and list.
+type luaGraphQLTable struct {
+	*lua.LTable
+}
+
+func (t luaGraphQLTable) Field(name string) (interface{}, bool) {
+	v := t.RawGetString(name)
+	if v == lua.LNil {
+		return nil, false
+	}
+	return luaGraphQLValue(v), true
+}
+
+func (t luaGraphQLTable) Items() []interface{} {
+	items := make([]interface{}, t.Len())
+	for i := range items {
+		items[i] = luaGraphQLValue(t.RawGetInt(i + 1))
+	}
+	return items
+}
+
+func (t luaGraphQLTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(luaScriptValueMarshal(t.LTable))
+}
+
+func luaGraphQLValue(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		return luaGraphQLTable{v}
+	}
+	return v.String()
+}
+
+// Converts field argument to Lua value.
+func luaGraphQLArg(l *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := l.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(luaGraphQLArg(l, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := l.CreateTable(0, len(v))
+		for k, item := range v {
+			t.RawSetString(k, luaGraphQLArg(l, item))
+		}
+		return t
+	}
+	return lua.LNil
+}
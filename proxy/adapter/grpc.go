@@ -0,0 +1,422 @@
+package adapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	gojson "encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lokhman/yams-lua"
+	"github.com/lokhman/yams-lua-json"
+	"github.com/lokhman/yams/proxy/model"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	grpcContentType    = "application/grpc"
+	grpcMaxMessageSize = 4 << 20
+
+	grpcHeaderStatus   = "Grpc-Status"
+	grpcHeaderMessage  = "Grpc-Message"
+	grpcHeaderEncoding = "Grpc-Encoding"
+	grpcHeaderTimeout  = "Grpc-Timeout"
+)
+
+// gRPC status codes, indexed by their values.
+var grpcCodes = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+const (
+	grpcCodeOK                = 0
+	grpcCodeInvalidArgument   = 3
+	grpcCodeDeadlineExceeded  = 4
+	grpcCodeResourceExhausted = 8
+	grpcCodeUnimplemented     = 12
+	grpcCodeInternal          = 13
+)
+
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s *grpcStatus) Error() string {
+	return fmt.Sprintf("%s: %s", grpcCodes[s.code], s.message)
+}
+
+// grpcScript runs Lua script for the method of gRPC service. Request messages
+// are decoded to tables, and returned table is encoded to response message.
+type grpcScript struct {
+	*luaScript
+	method   protoreflect.MethodDescriptor
+	requests []proto.Message
+	status   grpcStatus
+	trailer  http.Header
+	started  bool
+
+	// client is the context of the original request, which is not bounded
+	// by the call deadline.
+	client context.Context
+}
+
+func NewGRPCScript(r *model.Route, rw http.ResponseWriter, req *http.Request, sid string) *grpcScript {
+	s := &grpcScript{luaScript: NewLuaScript(r, rw, req, sid), trailer: make(http.Header), client: req.Context()}
+	s.extend, s.finish = s.loader, s.done
+	return s
+}
+
+func (s *grpcScript) Execute() error {
+	if s.req.Method != http.MethodPost || !isGRPCContentType(s.req.Header.Get("Content-Type")) {
+		return errors.New("yams: request is not a gRPC call")
+	}
+	if v := s.req.Header.Get(grpcHeaderTimeout); v != "" {
+		d, ok := grpcTimeout(v)
+		if !ok {
+			return s.fail(&grpcStatus{grpcCodeInvalidArgument, fmt.Sprintf("malformed timeout %q", v)})
+		}
+		// script is stopped by the deadline of the call or route timeout
+		ctx, cancel := context.WithTimeout(s.req.Context(), d)
+		defer cancel()
+		s.req = s.req.WithContext(ctx)
+	}
+	if err := s.resolve(); err != nil {
+		return s.fail(err)
+	}
+	if err := s.readRequests(); err != nil {
+		return s.fail(err)
+	}
+	return s.luaScript.Execute()
+}
+
+// Finds method descriptor by request path, i.e. "/package.Service/Method".
+func (s *grpcScript) resolve() error {
+	files := s.route.Profile.Descriptors()
+	if files == nil {
+		return &grpcStatus{grpcCodeUnimplemented, "no descriptor set is configured for the profile"}
+	}
+	path := strings.TrimPrefix(s.req.URL.Path, "/")
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return &grpcStatus{grpcCodeUnimplemented, fmt.Sprintf("malformed method name %q", s.req.URL.Path)}
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(path[:i]))
+	if err != nil {
+		return &grpcStatus{grpcCodeUnimplemented, fmt.Sprintf("unknown service %s", path[:i])}
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return &grpcStatus{grpcCodeUnimplemented, fmt.Sprintf("unknown service %s", path[:i])}
+	}
+	if s.method = sd.Methods().ByName(protoreflect.Name(path[i+1:])); s.method == nil {
+		return &grpcStatus{grpcCodeUnimplemented, fmt.Sprintf("unknown method %s for service %s", path[i+1:], path[:i])}
+	}
+	return nil
+}
+
+// Reads length-prefixed request messages.
+func (s *grpcScript) readRequests() error {
+	prefix := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(s.req.Body, prefix); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return &grpcStatus{grpcCodeInternal, err.Error()}
+		}
+		size := binary.BigEndian.Uint32(prefix[1:])
+		if size > grpcMaxMessageSize {
+			return &grpcStatus{grpcCodeResourceExhausted, fmt.Sprintf("message is larger than %d bytes", grpcMaxMessageSize)}
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(s.req.Body, data); err != nil {
+			return &grpcStatus{grpcCodeInternal, err.Error()}
+		}
+
+		if prefix[0] == 1 {
+			if encoding := s.req.Header.Get(grpcHeaderEncoding); encoding != "gzip" {
+				return &grpcStatus{grpcCodeUnimplemented, fmt.Sprintf("unsupported message encoding %q", encoding)}
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return &grpcStatus{grpcCodeInternal, err.Error()}
+			}
+			if data, err = ioutil.ReadAll(io.LimitReader(zr, grpcMaxMessageSize+1)); err != nil {
+				return &grpcStatus{grpcCodeInternal, err.Error()}
+			}
+			if len(data) > grpcMaxMessageSize {
+				return &grpcStatus{grpcCodeResourceExhausted, fmt.Sprintf("message is larger than %d bytes", grpcMaxMessageSize)}
+			}
+		}
+
+		msg := dynamicpb.NewMessage(s.method.Input())
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return &grpcStatus{grpcCodeInvalidArgument, err.Error()}
+		}
+		s.requests = append(s.requests, msg)
+	}
+}
+
+func (s *grpcScript) loader(l *lua.LState, mod *lua.LTable) {
+	t := l.NewTable()
+	l.SetField(t, "service", lua.LString(s.method.Parent().FullName()))
+	l.SetField(t, "method", lua.LString(s.method.Name()))
+
+	requests := l.CreateTable(len(s.requests), 0)
+	for _, msg := range s.requests {
+		requests.Append(s.decode(l, msg))
+	}
+	l.SetField(t, "requests", requests)
+	l.SetField(t, "request", requests.RawGetInt(1))
+
+	codes := l.CreateTable(0, len(grpcCodes))
+	for code, name := range grpcCodes {
+		codes.RawSetString(name, lua.LNumber(code))
+	}
+	l.SetField(t, "codes", codes)
+
+	l.SetFuncs(t, map[string]lua.LGFunction{
+		"setstatus":  s.fnSetStatus,
+		"settrailer": s.fnSetTrailer,
+		"send":       s.fnSend,
+	})
+	l.SetField(mod, "grpc", t)
+}
+
+// Decodes message to Lua table through its JSON mapping.
+func (s *grpcScript) decode(l *lua.LState, msg proto.Message) lua.LValue {
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	v, err := json.Decode(l, b)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Encodes Lua table to the response message through its JSON mapping.
+func (s *grpcScript) encode(v lua.LValue) ([]byte, error) {
+	b, err := gojson.Marshal(luaScriptValueMarshal(v))
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "null" {
+		// empty table
+		b = []byte("{}")
+	}
+	msg := dynamicpb.NewMessage(s.method.Output())
+	if err = protojson.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+func (s *grpcScript) writeHeader() {
+	if s.started {
+		return
+	}
+	s.started, s.committed = true, true
+	h := s.rw.Header()
+	h.Set("Content-Type", grpcContentType)
+	h.Del("Content-Length")
+	s.rw.WriteHeader(http.StatusOK)
+}
+
+func (s *grpcScript) writeMessage(b []byte) error {
+	s.writeHeader()
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	if _, err := s.rw.Write(prefix); err != nil {
+		return err
+	}
+	_, err := s.rw.Write(b)
+	return err
+}
+
+// Sends status and trailers. If no message was sent, they are sent in the
+// headers of trailers-only response.
+func (s *grpcScript) writeStatus() {
+	prefix := http.TrailerPrefix
+	if !s.started {
+		prefix = ""
+		s.rw.Header().Set("Content-Type", grpcContentType)
+	}
+	h := s.rw.Header()
+	for k, vv := range s.trailer {
+		h[prefix+k] = vv
+	}
+	h.Set(prefix+grpcHeaderStatus, strconv.Itoa(s.status.code))
+	if s.status.message != "" {
+		h.Set(prefix+grpcHeaderMessage, grpcEncodeMessage(s.status.message))
+	}
+	s.writeHeader()
+}
+
+// Sends status of the error, which occurred before script was executed.
+func (s *grpcScript) fail(err error) error {
+	st, ok := err.(*grpcStatus)
+	if !ok {
+		return err
+	}
+	s.status = *st
+	s.writeStatus()
+	return nil
+}
+
+func (s *grpcScript) done(l *lua.LState, err error) error {
+	if err != nil {
+		if s.client.Err() != nil {
+			return http.ErrAbortHandler
+		}
+		if s.req.Context().Err() == context.DeadlineExceeded {
+			s.status = grpcStatus{grpcCodeDeadlineExceeded, "deadline exceeded"}
+			s.writeStatus()
+			return nil
+		}
+		s.status = grpcStatus{grpcCodeInternal, "internal error"}
+		if s.route.Profile.IsDebug {
+			s.status.message = err.Error()
+		}
+	} else if s.status.code == grpcCodeOK {
+		v := lua.LValue(lua.LNil)
+		if top := l.GetTop(); top > 0 {
+			v = l.Get(top)
+		}
+		// unary response is required, and streaming response is optional
+		if v != lua.LNil || !s.method.IsStreamingServer() {
+			b, err := s.encode(v)
+			if err == nil {
+				err = s.writeMessage(b)
+			}
+			if err != nil {
+				s.status = grpcStatus{grpcCodeInternal, fmt.Sprintf("invalid response message: %v", err)}
+			}
+		}
+	}
+	s.writeStatus()
+	return nil
+}
+
+func (s *grpcScript) fnSetStatus(l *lua.LState) int {
+	code := l.CheckInt(1)
+	if code < 0 || code >= len(grpcCodes) {
+		l.ArgError(1, fmt.Sprintf("code must be a valid gRPC status code [0:%d]", len(grpcCodes)-1))
+	}
+	s.status = grpcStatus{code, l.OptString(2, "")}
+	return 0
+}
+
+func (s *grpcScript) fnSetTrailer(l *lua.LState) int {
+	k := l.CheckString(1)
+	if strings.HasPrefix(strings.ToLower(k), "grpc-") {
+		l.ArgError(1, "reserved trailers cannot be set")
+	}
+	s.trailer.Del(k)
+	for i := 2; i <= l.GetTop(); i++ {
+		s.trailer.Add(k, l.CheckString(i))
+	}
+	return 0
+}
+
+func (s *grpcScript) fnSend(l *lua.LState) int {
+	if !s.method.IsStreamingServer() {
+		l.RaiseError("method is not server-streaming, response message must be returned by the script")
+	}
+	b, err := s.encode(l.CheckTable(1))
+	if err != nil {
+		l.RaiseError("invalid response message: %s", err.Error())
+	}
+	if err = s.writeMessage(b); err == nil {
+		if f, ok := s.rw.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	if err != nil || s.req.Context().Err() != nil {
+		l.RaiseError("client has disconnected")
+	}
+	return 0
+}
+
+// Reports if content type is of gRPC over HTTP/2, i.e. "application/grpc"
+// with optional "+proto" subtype and parameters. gRPC-Web is not supported.
+func isGRPCContentType(ct string) bool {
+	ct = strings.ToLower(ct)
+	if !strings.HasPrefix(ct, grpcContentType) {
+		return false
+	}
+	ct = strings.TrimPrefix(ct[len(grpcContentType):], "+proto")
+	return ct == "" || ct[0] == ';'
+}
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// Parses value of the timeout header, i.e. at most 8 digits and time unit.
+func grpcTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	if time.Duration(n) > math.MaxInt64/unit {
+		// e.g. "99999999H", which is bounded by the route timeout anyway
+		return math.MaxInt64, true
+	}
+	return time.Duration(n) * unit, true
+}
+
+// Percent-encodes status message, as required by the protocol.
+func grpcEncodeMessage(msg string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,115 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lokhman/yams/yams"
+)
+
+// Limits response body of the outbound requests and of the fetched backend
+// responses, which is kept in memory.
+const httpMaxBody = yams.MaxFetchBodySize
+
+// httpClient sends outbound requests of the scripts, and follows redirects
+// only to the allowed hosts.
+var httpClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if hl, ok := req.Context().Value(httpAllowlistKey{}).(yams.HostList); ok && !hl.Allows(req.URL) {
+			return fmt.Errorf(`host "%s" is not allowed`, req.URL.Host)
+		}
+		return nil
+	},
+}
+
+type httpAllowlistKey struct{}
+
+// httpRequest is the outbound request of the script.
+type httpRequest struct {
+	Method  string
+	URL     string
+	Header  http.Header
+	Body    string
+	Timeout time.Duration
+}
+
+// httpResponse is the response of the outbound request or of the backend.
+type httpResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Checks request target against the allowlist of the profile, so scripts
+// cannot call arbitrary services.
+func (r *httpRequest) check(hl yams.HostList) error {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf(`unsupported scheme "%s"`, u.Scheme)
+	}
+	if !hl.Allows(u) {
+		return fmt.Errorf(`host "%s" is not allowed`, u.Host)
+	}
+	return nil
+}
+
+// Sends the request, which is bounded by the script context.
+func (r *httpRequest) do(ctx context.Context, hl yams.HostList) (*httpResponse, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	ctx = context.WithValue(ctx, httpAllowlistKey{}, hl)
+
+	var body io.Reader
+	if r.Body != "" {
+		body = strings.NewReader(r.Body)
+	}
+	req, err := http.NewRequest(strings.ToUpper(r.Method), r.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Header != nil {
+		req.Header = r.Header
+	}
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, httpMaxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > httpMaxBody {
+		return nil, fmt.Errorf("response body exceeds %d bytes", httpMaxBody)
+	}
+	return &httpResponse{Status: res.StatusCode, Header: res.Header, Body: b}, nil
+}
+
+// Reads the backend response returned by yams.Fetch.
+func newHTTPResponse(res *http.Response) (*httpResponse, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, httpMaxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > httpMaxBody {
+		return nil, fmt.Errorf("response body exceeds %d bytes", httpMaxBody)
+	}
+	return &httpResponse{Status: res.StatusCode, Header: res.Header, Body: b}, nil
+}
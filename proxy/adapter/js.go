@@ -0,0 +1,640 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+// Limits recursion of scripts, so they cannot exhaust memory with the stack.
+const jsMaxCallStackSize = 1024
+
+// jsExit interrupts the script, which is finished by exit(), pass() or dump().
+var jsExit = errors.New("exit")
+
+// jsScript runs JavaScript route script with the same "yams" module as
+// luaScript, which is loaded with require("yams").
+type jsScript struct {
+	vm     *goja.Runtime
+	ctx    context.Context
+	mod    *goja.Object
+	route  *model.Route
+	rw     http.ResponseWriter
+	req    *http.Request
+	sid    string
+	status int
+	wbuf   []func(w http.ResponseWriter)
+	assets map[*goja.Object]*asset
+	keys   cryptoKeys
+
+	// committed is set when response headers were sent by streaming.
+	committed bool
+}
+
+func init() {
+	model.RegisterCompiler(yams.AdapterJavaScript, jsCompile)
+}
+
+func jsCompile(r *model.Route) (interface{}, error) {
+	return goja.Compile("<script>", r.Script, false)
+}
+
+func NewJSScript(r *model.Route, rw http.ResponseWriter, req *http.Request, sid string) *jsScript {
+	return &jsScript{route: r, rw: rw, req: req, sid: sid, assets: make(map[*goja.Object]*asset)}
+}
+
+func (s *jsScript) Execute() error {
+	prog, ok := s.route.Program.(*goja.Program)
+	if !ok {
+		var err error
+		if prog, err = goja.Compile("<script>", s.route.Script, false); err != nil {
+			return err
+		}
+	}
+
+	s.vm = goja.New()
+	s.vm.SetMaxCallStackSize(jsMaxCallStackSize)
+	s.vm.Set("require", s.fnRequire)
+
+	// script is stopped by route timeout or if client has gone
+	var cancel context.CancelFunc
+	s.ctx, cancel = context.WithTimeout(s.req.Context(), time.Duration(s.route.Timeout)*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			s.vm.Interrupt(s.ctx.Err())
+		case <-done:
+		}
+	}()
+
+	_, err := s.vm.RunProgram(prog)
+	if ierr, ok := err.(*goja.InterruptedError); ok {
+		if ierr.Value() == jsExit {
+			err = nil
+		} else if cerr, ok := ierr.Value().(error); ok {
+			err = cerr
+		}
+	}
+	if err != nil {
+		if s.committed || s.req.Context().Err() != nil {
+			// streamed response cannot be replaced with the error page
+			return http.ErrAbortHandler
+		}
+		return err
+	}
+
+	s.commit()
+	return nil
+}
+
+// Sends response status and output buffer.
+func (s *jsScript) commit() {
+	if !s.committed {
+		s.committed = true
+		if s.status != 0 {
+			s.rw.WriteHeader(s.status)
+		}
+	}
+	for _, buf := range s.wbuf {
+		buf(s.rw)
+	}
+	s.wbuf = nil
+}
+
+// Throws error if response headers were already sent.
+func (s *jsScript) checkCommitted() {
+	if s.committed {
+		panic(s.vm.NewGoError(errors.New("response headers were already sent")))
+	}
+}
+
+func (s *jsScript) exit() goja.Value {
+	s.vm.Interrupt(jsExit)
+	return goja.Undefined()
+}
+
+func (s *jsScript) argError(i int, msg string) {
+	panic(s.vm.NewTypeError(fmt.Sprintf("bad argument #%d (%s)", i+1, msg)))
+}
+
+func (s *jsScript) checkAny(call goja.FunctionCall, i int) goja.Value {
+	v := call.Argument(i)
+	if goja.IsUndefined(v) {
+		s.argError(i, "value expected")
+	}
+	return v
+}
+
+func (s *jsScript) checkString(call goja.FunctionCall, i int) string {
+	return s.checkAny(call, i).String()
+}
+
+func (s *jsScript) optString(call goja.FunctionCall, i int, def string) string {
+	if v := call.Argument(i); !jsIsNil(v) {
+		return v.String()
+	}
+	return def
+}
+
+func (s *jsScript) optInt(call goja.FunctionCall, i int, def int) int {
+	if v := call.Argument(i); !jsIsNil(v) {
+		return int(v.ToInteger())
+	}
+	return def
+}
+
+func (s *jsScript) optBool(call goja.FunctionCall, i int, def bool) bool {
+	if v := call.Argument(i); !jsIsNil(v) {
+		return v.ToBoolean()
+	}
+	return def
+}
+
+func jsIsNil(v goja.Value) bool {
+	return v == nil || goja.IsUndefined(v) || goja.IsNull(v)
+}
+
+func jsValues(vv []string) []interface{} {
+	out := make([]interface{}, len(vv))
+	for i, v := range vv {
+		out[i] = v
+	}
+	return out
+}
+
+func jsValuesMap(m map[string][]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, vv := range m {
+		out[k] = jsValues(vv)
+	}
+	return out
+}
+
+func (s *jsScript) fnRequire(call goja.FunctionCall) goja.Value {
+	switch name := s.checkString(call, 0); name {
+	case "yams":
+		if s.mod == nil {
+			s.mod = s.loader()
+		}
+		return s.mod
+	case "base64":
+		mod := s.vm.NewObject()
+		mod.Set("encode", func(call goja.FunctionCall) goja.Value {
+			return s.vm.ToValue(base64.StdEncoding.EncodeToString([]byte(s.checkString(call, 0))))
+		})
+		mod.Set("decode", func(call goja.FunctionCall) goja.Value {
+			b, err := base64.StdEncoding.DecodeString(s.checkString(call, 0))
+			if err != nil {
+				return goja.Null()
+			}
+			return s.vm.ToValue(string(b))
+		})
+		return mod
+	case "crypto":
+		return s.cryptoLoader()
+	default:
+		panic(s.vm.NewGoError(fmt.Errorf("module %q not found", name)))
+	}
+}
+
+func (s *jsScript) loader() *goja.Object {
+	mod := s.vm.NewObject()
+
+	// constants
+	mod.Set("routeid", s.route.UUID)
+	mod.Set("method", s.req.Method)
+	mod.Set("scheme", s.req.URL.Scheme)
+	mod.Set("host", s.req.Host)
+	mod.Set("uri", s.req.URL.Path)
+	mod.Set("ip", yams.ClientIP(s.req))
+	mod.Set("sessionid", s.sid)
+	mod.Set("form", map[string]interface{}{})
+
+	// request path parameters
+	args := s.route.PathArgs()
+	path := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		switch v := arg.Value(s.route.Args[arg.Name]).(type) {
+		case int64, float64:
+			path[arg.Name] = v
+		default:
+			path[arg.Name] = s.route.Args[arg.Name]
+		}
+	}
+	mod.Set("path", path)
+
+	// profile host parameters
+	hostParams := make(map[string]interface{}, len(s.route.Profile.HostParams))
+	for k, v := range s.route.Profile.HostParams {
+		hostParams[k] = v
+	}
+	mod.Set("hostparams", hostParams)
+
+	mod.Set("headers", jsValuesMap(s.req.Header))
+	mod.Set("query", jsValuesMap(s.req.URL.Query()))
+
+	// cookies
+	cookies := s.req.Cookies()
+	cm := make(map[string]interface{}, len(cookies))
+	for _, cookie := range cookies {
+		cm[cookie.Name] = cookie.Value
+	}
+	mod.Set("cookies", cm)
+
+	// client certificate
+	if cc := yams.VerifyClientCert(s.req.TLS, s.route.Profile.ClientCAs()); cc != nil {
+		m := map[string]interface{}{
+			"subject":     cc.Subject,
+			"issuer":      cc.Issuer,
+			"serial":      cc.Serial,
+			"dnsnames":    jsValues(cc.DNSNames),
+			"emails":      jsValues(cc.Emails),
+			"ips":         jsValues(cc.IPs),
+			"uris":        jsValues(cc.URIs),
+			"fingerprint": cc.Fingerprint,
+			"notbefore":   cc.NotBefore,
+			"notafter":    cc.NotAfter,
+			"verified":    cc.Verified,
+		}
+		if cc.Error != "" {
+			m["error"] = cc.Error
+		}
+		mod.Set("clientcert", m)
+	} else {
+		mod.Set("clientcert", goja.Null())
+	}
+
+	// outbound requests
+	mod.Set("http", s.httpLoader())
+
+	// exposed functions
+	for name, fn := range map[string]func(goja.FunctionCall) goja.Value{
+		"setstatus":    s.fnSetStatus,
+		"getheader":    s.fnGetHeader,
+		"setheader":    s.fnSetHeader,
+		"setcookie":    s.fnSetCookie,
+		"parseform":    s.fnParseForm,
+		"getparam":     s.fnGetParam,
+		"getbody":      s.fnGetBody,
+		"asset":        s.fnAsset,
+		"sleep":        s.fnSleep,
+		"setbandwidth": s.fnSetBandwidth,
+		"write":        s.fnWrite,
+		"flush":        s.fnFlush,
+		"sse":          s.fnSSE,
+		"getvar":       s.fnGetVar,
+		"setvar":       s.fnSetVar,
+		"dump":         s.fnDump,
+		"wbclean":      s.fnWbClean,
+		"pass":         s.fnPass,
+		"fetch":        s.fnFetch,
+		"send":         s.fnSend,
+		"exit":         s.fnExit,
+	} {
+		mod.Set(name, fn)
+	}
+	return mod
+}
+
+func (s *jsScript) fnSetStatus(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	s.status = int(s.checkAny(call, 0).ToInteger())
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnGetHeader(call goja.FunctionCall) goja.Value {
+	return s.vm.ToValue(s.req.Header.Get(s.checkString(call, 0)))
+}
+
+func (s *jsScript) fnSetHeader(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	k, v := s.checkString(call, 0), s.checkString(call, 1)
+	s.rw.Header().Set(k, v)
+	for i := 2; i < len(call.Arguments); i++ {
+		s.rw.Header().Add(k, s.checkString(call, i))
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnSetCookie(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	cookie := &http.Cookie{
+		Name:     s.checkString(call, 0),
+		Value:    s.checkString(call, 1),
+		Path:     s.optString(call, 3, ""),
+		MaxAge:   s.optInt(call, 4, 0),
+		Secure:   s.optBool(call, 5, false),
+		HttpOnly: s.optBool(call, 6, false),
+	}
+	if expires := s.optInt(call, 2, 0); expires != 0 {
+		cookie.Expires = time.Now().Add(time.Duration(expires) * time.Second)
+	}
+	http.SetCookie(s.rw, cookie)
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnParseForm(call goja.FunctionCall) goja.Value {
+	form, err := parseForm(s.req, int64(s.optInt(call, 0, formMaxMemory)))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	s.mod.Set("form", jsValuesMap(form))
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnGetParam(call goja.FunctionCall) goja.Value {
+	k := s.checkString(call, 0)
+	if v, ok := s.req.URL.Query()[k]; ok && len(v) > 0 {
+		return s.vm.ToValue(v[0])
+	} else if v, ok := s.route.Args[k]; ok {
+		return s.vm.ToValue(v)
+	} else if v, ok := s.req.PostForm[k]; ok && len(v) > 0 {
+		return s.vm.ToValue(v[0])
+	}
+	return goja.Null()
+}
+
+func (s *jsScript) fnGetBody(call goja.FunctionCall) goja.Value {
+	if s.req.Body == http.NoBody {
+		return goja.Null()
+	}
+	if s.req.PostForm != nil || s.req.MultipartForm != nil {
+		panic(s.vm.NewGoError(errors.New("request body was already parsed")))
+	}
+	b, err := ioutil.ReadAll(s.req.Body)
+	if err != nil {
+		panic(err)
+	}
+	s.req.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+	return s.vm.ToValue(string(b))
+}
+
+func (s *jsScript) fnAsset(call goja.FunctionCall) goja.Value {
+	a := findAsset(s.route.Profile.Id, s.checkString(call, 0))
+	if a == nil {
+		return goja.Null()
+	}
+
+	obj := s.vm.NewObject()
+	obj.Set("getmimetype", func(goja.FunctionCall) goja.Value {
+		return s.vm.ToValue(a.mimeType)
+	})
+	obj.Set("getsize", func(goja.FunctionCall) goja.Value {
+		return s.vm.ToValue(a.size)
+	})
+	obj.Set("template", func(call goja.FunctionCall) goja.Value {
+		data := string(readAsset(a))
+		if yams.IsBinaryString(data) {
+			panic(s.vm.NewGoError(errors.New("template() function is not available for binary assets")))
+		}
+		buf := bytes.NewBuffer(nil)
+		t := template.Must(template.New(a.path).Parse(data))
+		if err := t.Execute(buf, s.checkAny(call, 0).Export()); err != nil {
+			panic(err)
+		}
+		return s.vm.ToValue(buf.String())
+	})
+	obj.Set("toString", func(goja.FunctionCall) goja.Value {
+		return s.vm.ToValue(string(readAsset(a)))
+	})
+	s.assets[obj] = a
+	return obj
+}
+
+func (s *jsScript) fnSleep(call goja.FunctionCall) goja.Value {
+	d := s.checkAny(call, 0).ToFloat()
+	if int(d) >= s.route.Timeout {
+		s.argError(0, fmt.Sprintf("duration must be lower than route timeout [%d]", s.route.Timeout))
+	}
+	t := time.NewTimer(time.Duration(d * float64(time.Second)))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-s.ctx.Done():
+		// script will be interrupted by the context
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnSetBandwidth(call goja.FunctionCall) goja.Value {
+	rate, ttfb := int(s.checkAny(call, 0).ToInteger()), s.optInt(call, 1, -1)
+	if rate < 0 {
+		s.argError(0, "rate must not be negative")
+	}
+	if tw, ok := s.rw.(yams.ThrottledWriter); ok {
+		tw.SetRate(rate, time.Duration(ttfb)*time.Millisecond)
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnWrite(call goja.FunctionCall) goja.Value {
+	for _, v := range call.Arguments {
+		if obj, ok := v.(*goja.Object); ok {
+			if a, ok := s.assets[obj]; ok {
+				s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+					loadAsset(w, a)
+				})
+				continue
+			}
+		}
+		str := v.String()
+		s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+			io.WriteString(w, str)
+		})
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnFlush(call goja.FunctionCall) goja.Value {
+	s.commit()
+	if f, ok := s.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	if s.req.Context().Err() != nil {
+		panic(s.vm.NewGoError(errors.New("client has disconnected")))
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnSSE(call goja.FunctionCall) goja.Value {
+	event, v, id := s.optString(call, 0, ""), s.checkAny(call, 1), s.optString(call, 2, "")
+	if strings.ContainsAny(event, "\r\n") {
+		s.argError(0, "event must not contain line breaks")
+	}
+	if strings.ContainsAny(id, "\r\n") {
+		s.argError(2, "id must not contain line breaks")
+	}
+
+	var data string
+	if _, ok := v.(*goja.Object); ok {
+		b, err := json.Marshal(v.Export())
+		if err != nil {
+			s.argError(1, err.Error())
+		}
+		data = string(b)
+	} else {
+		data = v.String()
+	}
+
+	if !s.committed {
+		h := s.rw.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", "text/event-stream")
+		}
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "no-cache")
+		}
+	}
+
+	var buf bytes.Buffer
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+
+	b := buf.Bytes()
+	s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+		w.Write(b)
+	})
+	return s.fnFlush(call)
+}
+
+func (s *jsScript) fnGetVar(call goja.FunctionCall) goja.Value {
+	k := s.checkString(call, 0)
+	var sid *string
+	if s.optBool(call, 1, false) {
+		sid = &s.sid
+	}
+	vb := getVar(s.route.Profile.Id, sid, k)
+	if vb == nil {
+		return goja.Null()
+	}
+	var v interface{}
+	if err := json.Unmarshal(vb, &v); err != nil {
+		panic(err)
+	}
+	return s.vm.ToValue(v)
+}
+
+func (s *jsScript) fnSetVar(call goja.FunctionCall) goja.Value {
+	k := strings.TrimSpace(s.checkString(call, 0))
+	if k == "" || len(k) > 255 {
+		s.argError(0, "key must be a string of valid length [1:255]")
+	}
+	var sid *string
+	if s.optBool(call, 2, false) {
+		sid = &s.sid
+	}
+	if v := call.Argument(1); !jsIsNil(v) {
+		lt := s.optInt(call, 3, s.route.Profile.VarsLifetime)
+		if lt > s.route.Profile.VarsLifetime {
+			s.argError(3, fmt.Sprintf("lifetime must not exceed profile setting [%d]", s.route.Profile.VarsLifetime))
+		}
+		vb, err := json.Marshal(v.Export())
+		if err != nil {
+			s.argError(1, err.Error())
+		}
+		setVar(s.route.Profile.Id, sid, k, vb, lt)
+	} else {
+		setVar(s.route.Profile.Id, sid, k, nil, 0)
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnDump(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	b, err := httputil.DumpRequest(s.req, s.optBool(call, 0, false))
+	if err != nil {
+		panic(err)
+	}
+	if _, err = s.rw.Write(b); err != nil {
+		panic(err)
+	}
+	s.status, s.wbuf = 0, nil
+	return s.exit()
+}
+
+func (s *jsScript) fnWbClean(call goja.FunctionCall) goja.Value {
+	s.wbuf = nil
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnPass(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	p := s.route.Profile
+	if p.Balancer != nil && jsIsNil(call.Argument(0)) {
+		p.Balancer.ReverseProxy(s.rw, s.req, p.Upstream, p.IsDebug)
+	} else {
+		yams.ReverseProxy(s.rw, s.req, s.checkString(call, 0), p.Upstream, p.IsDebug)
+	}
+	s.status, s.wbuf = 0, nil
+	return s.exit()
+}
+
+func (s *jsScript) fnFetch(call goja.FunctionCall) goja.Value {
+	p := s.route.Profile
+	var res *http.Response
+	var err error
+	if p.Balancer != nil && jsIsNil(call.Argument(0)) {
+		res, err = p.Balancer.Fetch(s.ctx, s.req, p.Upstream, p.IsDebug)
+	} else {
+		res, err = yams.Fetch(s.ctx, s.req, s.checkString(call, 0), p.Upstream, p.IsDebug)
+	}
+	if err != nil {
+		panic(s.vm.NewGoError(err))
+	}
+	hr, err := newHTTPResponse(res)
+	if err != nil {
+		panic(s.vm.NewGoError(err))
+	}
+	return s.httpResponse(hr)
+}
+
+func (s *jsScript) fnSend(call goja.FunctionCall) goja.Value {
+	s.checkCommitted()
+	obj := s.checkAny(call, 0).ToObject(s.vm)
+	if status := obj.Get("status"); !jsIsNil(status) {
+		s.status = int(status.ToInteger())
+	}
+	if headers := obj.Get("headers"); !jsIsNil(headers) {
+		for k, vv := range s.header(headers) {
+			s.rw.Header()[k] = vv
+		}
+	}
+	if body := obj.Get("body"); !jsIsNil(body) {
+		str := body.String()
+		s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+			io.WriteString(w, str)
+		})
+	}
+	return goja.Undefined()
+}
+
+func (s *jsScript) fnExit(call goja.FunctionCall) goja.Value {
+	return s.exit()
+}
@@ -0,0 +1,136 @@
+package adapter
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/dop251/goja"
+)
+
+func (s *jsScript) cryptoLoader() *goja.Object {
+	mod := s.vm.NewObject()
+	for name, fn := range map[string]func(goja.FunctionCall) goja.Value{
+		"md5":     s.cryptoDigest(crypto.MD5),
+		"sha1":    s.cryptoDigest(crypto.SHA1),
+		"sha256":  s.cryptoDigest(crypto.SHA256),
+		"sha512":  s.cryptoDigest(crypto.SHA512),
+		"hmac":    s.fnCryptoHMAC,
+		"random":  s.fnCryptoRandom,
+		"hex":     s.fnCryptoHex,
+		"unhex":   s.fnCryptoUnhex,
+		"equal":   s.fnCryptoEqual,
+		"encrypt": s.fnCryptoEncrypt,
+		"decrypt": s.fnCryptoDecrypt,
+		"sign":    s.fnCryptoSign,
+		"verify":  s.fnCryptoVerify,
+	} {
+		mod.Set(name, fn)
+	}
+	return mod
+}
+
+func (s *jsScript) cryptoHash(call goja.FunctionCall, i int) crypto.Hash {
+	h, err := cryptoHash(s.optString(call, i, "sha256"))
+	if err != nil {
+		s.argError(i, err.Error())
+	}
+	return h
+}
+
+// Returns binary result with encoding from the argument i.
+func (s *jsScript) cryptoResult(call goja.FunctionCall, i int, b []byte) goja.Value {
+	str, err := cryptoEncode(b, s.optString(call, i, "hex"))
+	if err != nil {
+		s.argError(i, err.Error())
+	}
+	return s.vm.ToValue(str)
+}
+
+func (s *jsScript) cryptoDigest(h crypto.Hash) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		return s.cryptoResult(call, 1, cryptoDigest(h, []byte(s.checkString(call, 0))))
+	}
+}
+
+func (s *jsScript) fnCryptoHMAC(call goja.FunctionCall) goja.Value {
+	h, err := cryptoHash(s.checkString(call, 0))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	return s.cryptoResult(call, 3, cryptoHMAC(h, []byte(s.checkString(call, 1)), []byte(s.checkString(call, 2))))
+}
+
+func (s *jsScript) fnCryptoRandom(call goja.FunctionCall) goja.Value {
+	b, err := cryptoRandom(int(s.checkAny(call, 0).ToInteger()))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	return s.cryptoResult(call, 1, b)
+}
+
+func (s *jsScript) fnCryptoHex(call goja.FunctionCall) goja.Value {
+	return s.vm.ToValue(hex.EncodeToString([]byte(s.checkString(call, 0))))
+}
+
+func (s *jsScript) fnCryptoUnhex(call goja.FunctionCall) goja.Value {
+	b, err := hex.DecodeString(s.checkString(call, 0))
+	if err != nil {
+		return goja.Null()
+	}
+	return s.vm.ToValue(string(b))
+}
+
+func (s *jsScript) fnCryptoEqual(call goja.FunctionCall) goja.Value {
+	a, b := s.checkString(call, 0), s.checkString(call, 1)
+	return s.vm.ToValue(subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1)
+}
+
+func (s *jsScript) fnCryptoEncrypt(call goja.FunctionCall) goja.Value {
+	b, err := cryptoEncrypt([]byte(s.checkString(call, 0)), []byte(s.checkString(call, 1)))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	return s.cryptoResult(call, 2, b)
+}
+
+func (s *jsScript) fnCryptoDecrypt(call goja.FunctionCall) goja.Value {
+	key := []byte(s.checkString(call, 0))
+	data, err := cryptoDecode(s.checkString(call, 1), s.optString(call, 2, "hex"))
+	if err == nil {
+		data, err = cryptoDecrypt(key, data)
+	}
+	if err != nil {
+		return goja.Null()
+	}
+	return s.vm.ToValue(string(data))
+}
+
+func (s *jsScript) fnCryptoSign(call goja.FunctionCall) goja.Value {
+	key, err := s.keys.load(s.route.Profile.Id, s.checkString(call, 0))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	sig, err := cryptoSign(key, s.cryptoHash(call, 2), []byte(s.checkString(call, 1)))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	return s.cryptoResult(call, 3, sig)
+}
+
+func (s *jsScript) fnCryptoVerify(call goja.FunctionCall) goja.Value {
+	key, err := s.keys.load(s.route.Profile.Id, s.checkString(call, 0))
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	data, h := []byte(s.checkString(call, 1)), s.cryptoHash(call, 3)
+	sig, err := cryptoDecode(s.checkString(call, 2), s.optString(call, 4, "hex"))
+	if err != nil {
+		return s.vm.ToValue(false)
+	}
+	ok, err := cryptoVerify(key, h, data, sig)
+	if err != nil {
+		s.argError(0, err.Error())
+	}
+	return s.vm.ToValue(ok)
+}
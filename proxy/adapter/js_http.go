@@ -0,0 +1,93 @@
+package adapter
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func (s *jsScript) httpLoader() *goja.Object {
+	obj := s.vm.NewObject()
+	obj.Set("request", s.fnHTTPRequest)
+	obj.Set("get", s.fnHTTPGet)
+	obj.Set("post", s.fnHTTPPost)
+	return obj
+}
+
+// Converts object of header values, which are strings or arrays of strings.
+func (s *jsScript) header(v goja.Value) http.Header {
+	h := make(http.Header)
+	obj := v.ToObject(s.vm)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		if vv, ok := v.Export().([]interface{}); ok {
+			for _, v := range vv {
+				h.Add(k, fmt.Sprint(v))
+			}
+		} else {
+			h.Add(k, v.String())
+		}
+	}
+	return h
+}
+
+func (s *jsScript) httpResponse(res *httpResponse) *goja.Object {
+	obj := s.vm.NewObject()
+	obj.Set("status", res.Status)
+	obj.Set("headers", jsValuesMap(res.Header))
+	obj.Set("body", string(res.Body))
+	return obj
+}
+
+// Sends the request and returns response, or throws error.
+func (s *jsScript) httpDo(r *httpRequest) goja.Value {
+	if err := r.check(s.route.Profile.HTTPAllowlist); err != nil {
+		panic(s.vm.NewGoError(err))
+	}
+	res, err := r.do(s.ctx, s.route.Profile.HTTPAllowlist)
+	if err != nil {
+		panic(s.vm.NewGoError(err))
+	}
+	return s.httpResponse(res)
+}
+
+func (s *jsScript) fnHTTPRequest(call goja.FunctionCall) goja.Value {
+	obj := s.checkAny(call, 0).ToObject(s.vm)
+	r := &httpRequest{Method: http.MethodGet}
+	if v := obj.Get("method"); !jsIsNil(v) {
+		r.Method = v.String()
+	}
+	if v := obj.Get("url"); !jsIsNil(v) {
+		r.URL = v.String()
+	} else {
+		s.argError(0, "url must be a string")
+	}
+	if v := obj.Get("headers"); !jsIsNil(v) {
+		r.Header = s.header(v)
+	}
+	if v := obj.Get("body"); !jsIsNil(v) {
+		r.Body = v.String()
+	}
+	if v := obj.Get("timeout"); !jsIsNil(v) {
+		r.Timeout = time.Duration(v.ToFloat() * float64(time.Second))
+	}
+	return s.httpDo(r)
+}
+
+func (s *jsScript) fnHTTPGet(call goja.FunctionCall) goja.Value {
+	r := &httpRequest{Method: http.MethodGet, URL: s.checkString(call, 0)}
+	if v := call.Argument(1); !jsIsNil(v) {
+		r.Header = s.header(v)
+	}
+	return s.httpDo(r)
+}
+
+func (s *jsScript) fnHTTPPost(call goja.FunctionCall) goja.Value {
+	r := &httpRequest{Method: http.MethodPost, URL: s.checkString(call, 0), Body: s.optString(call, 1, "")}
+	if v := call.Argument(2); !jsIsNil(v) {
+		r.Header = s.header(v)
+	}
+	return s.httpDo(r)
+}
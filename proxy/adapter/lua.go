@@ -3,14 +3,11 @@ package adapter
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"strconv"
 	"strings"
 	"text/template"
@@ -19,12 +16,11 @@ import (
 	"github.com/lokhman/yams-lua"
 	"github.com/lokhman/yams-lua-base64"
 	"github.com/lokhman/yams-lua-json"
+	"github.com/lokhman/yams-lua/parse"
 	"github.com/lokhman/yams/proxy/model"
 	"github.com/lokhman/yams/yams"
 )
 
-const luaMaxMemory = 64 << 20
-
 type luaScript struct {
 	mod    *lua.LTable
 	route  *model.Route
@@ -33,6 +29,30 @@ type luaScript struct {
 	sid    string
 	status int
 	wbuf   []func(w http.ResponseWriter)
+
+	// committed is set when response headers were sent by streaming.
+	committed bool
+	ws        *luaWS
+	keys      cryptoKeys
+
+	// extend adds adapter functions to the module, and finish replaces
+	// sending of the response when script is finished.
+	extend func(l *lua.LState, mod *lua.LTable)
+	finish func(l *lua.LState, err error) error
+}
+
+func init() {
+	model.RegisterCompiler(yams.AdapterLua, luaCompile)
+	model.RegisterCompiler(yams.AdapterGRPC, luaCompile)
+	model.RegisterCompiler(yams.AdapterGraphQL, luaCompile)
+}
+
+func luaCompile(r *model.Route) (interface{}, error) {
+	chunk, err := parse.Parse(strings.NewReader(r.Script), "<string>")
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, "<string>")
 }
 
 func NewLuaScript(r *model.Route, rw http.ResponseWriter, req *http.Request, sid string) *luaScript {
@@ -47,22 +67,59 @@ func (s *luaScript) Execute() error {
 	base64.Preload(l)
 
 	l.PreloadModule("yams", s.loader)
+	l.PreloadModule("crypto", s.cryptoLoader)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.route.Timeout)*time.Second)
+	// script is stopped by route timeout or if client has gone
+	ctx, cancel := context.WithTimeout(s.req.Context(), time.Duration(s.route.Timeout)*time.Second)
 	defer cancel()
 
 	l.SetContext(ctx)
-	if err := l.DoString(s.route.Script); err != nil {
+	var err error
+	if proto, ok := s.route.Program.(*lua.FunctionProto); ok {
+		l.Push(l.NewFunctionFromProto(proto))
+		err = l.PCall(0, lua.MultRet, nil)
+	} else {
+		err = l.DoString(s.route.Script)
+	}
+	if s.ws != nil {
+		s.ws.finish()
+	}
+	if s.finish != nil {
+		return s.finish(l, err)
+	}
+	if err != nil {
+		if s.committed || s.req.Context().Err() != nil {
+			// streamed response cannot be replaced with the error page
+			return http.ErrAbortHandler
+		}
 		return err
 	}
 
-	if s.status != 0 {
-		s.rw.WriteHeader(s.status)
+	if s.ws == nil {
+		s.commit()
+	}
+	return nil
+}
+
+// Sends response status and output buffer.
+func (s *luaScript) commit() {
+	if !s.committed {
+		s.committed = true
+		if s.status != 0 {
+			s.rw.WriteHeader(s.status)
+		}
 	}
 	for _, buf := range s.wbuf {
 		buf(s.rw)
 	}
-	return nil
+	s.wbuf = nil
+}
+
+// Raises error if response headers were already sent.
+func (s *luaScript) checkCommitted(l *lua.LState) {
+	if s.committed {
+		l.RaiseError("response headers were already sent")
+	}
 }
 
 func (s *luaScript) loader(l *lua.LState) int {
@@ -82,12 +139,27 @@ func (s *luaScript) loader(l *lua.LState) int {
 	// l.SetField(s.mod, "files", l.CreateTable(0, 0))
 
 	// request path parameters
-	t := l.CreateTable(0, len(s.route.Args))
-	for k, v := range s.route.Args {
-		t.RawSetString(k, lua.LString(v))
+	args := s.route.PathArgs()
+	t := l.CreateTable(0, len(args))
+	for _, arg := range args {
+		switch v := arg.Value(s.route.Args[arg.Name]).(type) {
+		case int64:
+			t.RawSetString(arg.Name, lua.LNumber(v))
+		case float64:
+			t.RawSetString(arg.Name, lua.LNumber(v))
+		default:
+			t.RawSetString(arg.Name, lua.LString(s.route.Args[arg.Name]))
+		}
 	}
 	l.SetField(s.mod, "path", t)
 
+	// profile host parameters
+	t = l.CreateTable(0, len(s.route.Profile.HostParams))
+	for k, v := range s.route.Profile.HostParams {
+		t.RawSetString(k, lua.LString(v))
+	}
+	l.SetField(s.mod, "hostparams", t)
+
 	// request headers
 	t = l.CreateTable(0, len(s.req.Header))
 	for k, vv := range s.req.Header {
@@ -119,24 +191,55 @@ func (s *luaScript) loader(l *lua.LState) int {
 	}
 	l.SetField(s.mod, "cookies", t)
 
+	// client certificate
+	if cc := yams.VerifyClientCert(s.req.TLS, s.route.Profile.ClientCAs()); cc != nil {
+		t = l.CreateTable(0, 12)
+		t.RawSetString("subject", lua.LString(cc.Subject))
+		t.RawSetString("issuer", lua.LString(cc.Issuer))
+		t.RawSetString("serial", lua.LString(cc.Serial))
+		t.RawSetString("dnsnames", luaStringList(l, cc.DNSNames))
+		t.RawSetString("emails", luaStringList(l, cc.Emails))
+		t.RawSetString("ips", luaStringList(l, cc.IPs))
+		t.RawSetString("uris", luaStringList(l, cc.URIs))
+		t.RawSetString("fingerprint", lua.LString(cc.Fingerprint))
+		t.RawSetString("notbefore", lua.LNumber(cc.NotBefore))
+		t.RawSetString("notafter", lua.LNumber(cc.NotAfter))
+		t.RawSetString("verified", lua.LBool(cc.Verified))
+		if cc.Error != "" {
+			t.RawSetString("error", lua.LString(cc.Error))
+		}
+		l.SetField(s.mod, "clientcert", t)
+	}
+
+	// websocket connection
+	l.SetField(s.mod, "ws", s.wsLoader(l))
+
+	// outbound requests
+	l.SetField(s.mod, "http", s.httpLoader(l))
+
 	// exposed functions
 	l.SetFuncs(s.mod, map[string]lua.LGFunction{
-		"setstatus": s.fnSetStatus,
-		"getheader": s.fnGetHeader,
-		"setheader": s.fnSetHeader,
-		"setcookie": s.fnSetCookie,
-		"parseform": s.fnParseForm,
-		"getparam":  s.fnGetParam,
-		"getbody":   s.fnGetBody,
-		"asset":     s.fnAsset,
-		"sleep":     s.fnSleep,
-		"write":     s.fnWrite,
-		"getvar":    s.fnGetVar,
-		"setvar":    s.fnSetVar,
-		"dump":      s.fnDump,
-		"wbclean":   s.fnWbClean,
-		"pass":      s.fnPass,
-		"exit":      s.fnExit,
+		"setstatus":    s.fnSetStatus,
+		"getheader":    s.fnGetHeader,
+		"setheader":    s.fnSetHeader,
+		"setcookie":    s.fnSetCookie,
+		"parseform":    s.fnParseForm,
+		"getparam":     s.fnGetParam,
+		"getbody":      s.fnGetBody,
+		"asset":        s.fnAsset,
+		"sleep":        s.fnSleep,
+		"setbandwidth": s.fnSetBandwidth,
+		"write":        s.fnWrite,
+		"flush":        s.fnFlush,
+		"sse":          s.fnSSE,
+		"getvar":       s.fnGetVar,
+		"setvar":       s.fnSetVar,
+		"dump":         s.fnDump,
+		"wbclean":      s.fnWbClean,
+		"pass":         s.fnPass,
+		"fetch":        s.fnFetch,
+		"send":         s.fnSend,
+		"exit":         s.fnExit,
 	})
 
 	// register asset type
@@ -149,11 +252,23 @@ func (s *luaScript) loader(l *lua.LState) int {
 		"__tostring":  luaAssetFnToString,
 	})
 
+	if s.extend != nil {
+		s.extend(l, s.mod)
+	}
 	l.Push(s.mod)
 	return 1
 }
 
+func luaStringList(l *lua.LState, ss []string) *lua.LTable {
+	t := l.CreateTable(len(ss), 0)
+	for _, v := range ss {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
 func (s *luaScript) fnSetStatus(l *lua.LState) int {
+	s.checkCommitted(l)
 	s.status = int(l.CheckNumber(1))
 	return 0
 }
@@ -164,6 +279,7 @@ func (s *luaScript) fnGetHeader(l *lua.LState) int {
 }
 
 func (s *luaScript) fnSetHeader(l *lua.LState) int {
+	s.checkCommitted(l)
 	k, v := l.CheckString(1), l.CheckString(2)
 	s.rw.Header().Set(k, v)
 	for i := 3; i <= l.GetTop(); i++ {
@@ -174,6 +290,7 @@ func (s *luaScript) fnSetHeader(l *lua.LState) int {
 }
 
 func (s *luaScript) fnSetCookie(l *lua.LState) int {
+	s.checkCommitted(l)
 	cookie := &http.Cookie{
 		Name:     l.CheckString(1),
 		Value:    l.CheckString(2),
@@ -190,16 +307,9 @@ func (s *luaScript) fnSetCookie(l *lua.LState) int {
 }
 
 func (s *luaScript) fnParseForm(l *lua.LState) int {
-	mem := l.OptInt64(1, luaMaxMemory)
-	if mem > luaMaxMemory {
-		l.ArgError(1, fmt.Sprintf("maxmemory value must be not higher than %d", luaMaxMemory))
-	}
-	s.req.ParseMultipartForm(mem)
-	var form url.Values
-	if s.req.MultipartForm != nil {
-		form = s.req.MultipartForm.Value
-	} else {
-		form = s.req.PostForm
+	form, err := parseForm(s.req, l.OptInt64(1, formMaxMemory))
+	if err != nil {
+		l.ArgError(1, err.Error())
 	}
 	t := l.GetField(s.mod, "form").(*lua.LTable)
 	for k, vv := range form {
@@ -245,14 +355,10 @@ func (s *luaScript) fnGetBody(l *lua.LState) int {
 }
 
 func (s *luaScript) fnAsset(l *lua.LState) int {
-	a := &luaAsset{path: l.CheckString(1)}
-	q := `SELECT id, mime_type, octet_length(data) FROM assets WHERE profile_id = $1 AND path = $2`
-	if err := yams.DB.QueryRow(q, s.route.Profile.Id, a.path).Scan(&a.id, &a.mimeType, &a.size); err != nil {
-		if err == sql.ErrNoRows {
-			l.Push(lua.LNil)
-			return 1
-		}
-		panic(err)
+	a := findAsset(s.route.Profile.Id, l.CheckString(1))
+	if a == nil {
+		l.Push(lua.LNil)
+		return 1
 	}
 	ud := l.NewUserData()
 	ud.Value = a
@@ -266,7 +372,25 @@ func (s *luaScript) fnSleep(l *lua.LState) int {
 	if int(d) >= s.route.Timeout {
 		l.ArgError(1, fmt.Sprintf("duration must be lower than route timeout [%d]", s.route.Timeout))
 	}
-	time.Sleep(time.Duration(d) * time.Second)
+	t := time.NewTimer(time.Duration(float64(d) * float64(time.Second)))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-l.Context().Done():
+		// script will be stopped by the context
+	}
+	return 0
+}
+
+func (s *luaScript) fnSetBandwidth(l *lua.LState) int {
+	rate, ttfb := l.CheckInt(1), l.OptInt(2, -1)
+	if rate < 0 {
+		l.ArgError(1, "rate must not be negative")
+	}
+	if tw, ok := s.rw.(yams.ThrottledWriter); ok {
+		tw.SetRate(rate, time.Duration(ttfb)*time.Millisecond)
+	}
 	return 0
 }
 
@@ -275,9 +399,9 @@ func (s *luaScript) fnWrite(l *lua.LState) int {
 		v := l.Get(i)
 		if ud, ok := v.(*lua.LUserData); ok {
 			switch v := ud.Value.(type) {
-			case *luaAsset:
+			case *asset:
 				s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
-					luaAssetLoad(w, v)
+					loadAsset(w, v)
 				})
 				continue
 			}
@@ -289,24 +413,76 @@ func (s *luaScript) fnWrite(l *lua.LState) int {
 	return 0
 }
 
+func (s *luaScript) fnFlush(l *lua.LState) int {
+	s.commit()
+	if f, ok := s.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	if s.req.Context().Err() != nil {
+		l.RaiseError("client has disconnected")
+	}
+	return 0
+}
+
+func (s *luaScript) fnSSE(l *lua.LState) int {
+	event, v, id := l.OptString(1, ""), l.CheckAny(2), l.OptString(3, "")
+	if strings.ContainsAny(event, "\r\n") {
+		l.ArgError(1, "event must not contain line breaks")
+	}
+	if strings.ContainsAny(id, "\r\n") {
+		l.ArgError(3, "id must not contain line breaks")
+	}
+
+	var data string
+	if t, ok := v.(*lua.LTable); ok {
+		b, err := json.Encode(t)
+		if err != nil {
+			panic(err)
+		}
+		data = string(b)
+	} else {
+		data = v.String()
+	}
+
+	if !s.committed {
+		h := s.rw.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", "text/event-stream")
+		}
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "no-cache")
+		}
+	}
+
+	var buf bytes.Buffer
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+
+	b := buf.Bytes()
+	s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+		w.Write(b)
+	})
+	return s.fnFlush(l)
+}
+
 func (s *luaScript) fnGetVar(l *lua.LState) int {
 	k := l.CheckString(1)
 	var sid *string
 	if l.OptBool(2, false) {
 		sid = &s.sid
 	}
-	var vb []byte
-	q := `SELECT value FROM storage WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3 AND expires_at > now()`
-	if err := yams.DB.QueryRow(q, s.route.Profile.Id, sid, k).Scan(&vb); err != nil {
-		if err == sql.ErrNoRows {
-			l.Push(lua.LNil)
-			return 1
-		}
-		panic(err)
-	}
-	q = `UPDATE storage SET expires_at = now()+(expires_at-updated_at) WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3`
-	if _, err := yams.DB.Exec(q, s.route.Profile.Id, sid, k); err != nil {
-		panic(err)
+	vb := getVar(s.route.Profile.Id, sid, k)
+	if vb == nil {
+		l.Push(lua.LNil)
+		return 1
 	}
 	v, err := json.Decode(l, vb)
 	if err != nil {
@@ -334,20 +510,15 @@ func (s *luaScript) fnSetVar(l *lua.LState) int {
 		if err != nil {
 			panic(err)
 		}
-		q := `INSERT INTO storage (profile_id, sid, key, value, expires_at) VALUES ($1, $2, $3, $4, now() + $5 * INTERVAL '1 second') ON CONFLICT (COALESCE(sid, ''), profile_id, key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`
-		if _, err = yams.DB.Exec(q, s.route.Profile.Id, sid, k, vb, lt); err != nil {
-			panic(err)
-		}
+		setVar(s.route.Profile.Id, sid, k, vb, lt)
 	} else {
-		q := `DELETE FROM storage WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3`
-		if _, err := yams.DB.Exec(q, s.route.Profile.Id, sid, k); err != nil {
-			panic(err)
-		}
+		setVar(s.route.Profile.Id, sid, k, nil, 0)
 	}
 	return 0
 }
 
 func (s *luaScript) fnDump(l *lua.LState) int {
+	s.checkCommitted(l)
 	b, err := httputil.DumpRequest(s.req, l.OptBool(1, false))
 	if err != nil {
 		panic(err)
@@ -366,19 +537,57 @@ func (s *luaScript) fnWbClean(l *lua.LState) int {
 }
 
 func (s *luaScript) fnPass(l *lua.LState) int {
-	backend := s.route.Profile.Backend
-	var target string
-	if backend != nil {
-		target = l.OptString(1, *backend)
+	s.checkCommitted(l)
+	p := s.route.Profile
+	if p.Balancer != nil && l.Get(1) == lua.LNil {
+		p.Balancer.ReverseProxy(s.rw, s.req, p.Upstream, p.IsDebug)
 	} else {
-		target = l.CheckString(1)
+		yams.ReverseProxy(s.rw, s.req, l.CheckString(1), p.Upstream, p.IsDebug)
 	}
-	yams.ReverseProxy(s.rw, s.req, target, s.route.Profile.IsDebug)
 	s.status, s.wbuf = 0, nil
 	l.Exit()
 	return 0
 }
 
+func (s *luaScript) fnFetch(l *lua.LState) int {
+	p := s.route.Profile
+	var res *http.Response
+	var err error
+	if p.Balancer != nil && l.Get(1) == lua.LNil {
+		res, err = p.Balancer.Fetch(l.Context(), s.req, p.Upstream, p.IsDebug)
+	} else {
+		res, err = yams.Fetch(l.Context(), s.req, l.CheckString(1), p.Upstream, p.IsDebug)
+	}
+	if err != nil {
+		l.RaiseError(err.Error())
+	}
+	hr, err := newHTTPResponse(res)
+	if err != nil {
+		l.RaiseError(err.Error())
+	}
+	l.Push(luaHTTPResponse(l, hr))
+	return 1
+}
+
+func (s *luaScript) fnSend(l *lua.LState) int {
+	s.checkCommitted(l)
+	t := l.CheckTable(1)
+	if status, ok := t.RawGetString("status").(lua.LNumber); ok {
+		s.status = int(status)
+	}
+	if h, ok := t.RawGetString("headers").(*lua.LTable); ok {
+		for k, vv := range luaHeader(h) {
+			s.rw.Header()[k] = vv
+		}
+	}
+	if body := t.RawGetString("body"); body != lua.LNil {
+		s.wbuf = append(s.wbuf, func(w http.ResponseWriter) {
+			fmt.Fprint(w, body)
+		})
+	}
+	return 0
+}
+
 func (s *luaScript) fnExit(l *lua.LState) int {
 	l.Exit()
 	return 0
@@ -386,45 +595,15 @@ func (s *luaScript) fnExit(l *lua.LState) int {
 
 const luaLAssetClass = "ASSET*"
 
-type luaAsset struct {
-	id       int
-	path     string
-	mimeType string
-	size     int
-}
-
-func luaAssetCheck(l *lua.LState) *luaAsset {
+func luaAssetCheck(l *lua.LState) *asset {
 	ud := l.CheckUserData(1)
-	if v, ok := ud.Value.(*luaAsset); ok {
+	if v, ok := ud.Value.(*asset); ok {
 		return v
 	}
 	l.ArgError(1, "asset expected")
 	return nil
 }
 
-// Writes asset data directly to Writer.
-func luaAssetLoad(w io.Writer, a *luaAsset) {
-	var data sql.RawBytes
-	rows, err := yams.DB.Query(`SELECT data FROM assets WHERE id = $1`, a.id)
-	if err != nil {
-		panic(err)
-	}
-	defer rows.Close()
-	if !rows.Next() {
-		return
-	}
-	if err = rows.Scan(&data); err != nil {
-		panic(err)
-	}
-	w.Write(data)
-}
-
-func luaAssetRead(a *luaAsset) []byte {
-	buf := bytes.NewBuffer(nil)
-	luaAssetLoad(buf, a)
-	return buf.Bytes()
-}
-
 func luaAssetFnGetMimeType(l *lua.LState) int {
 	l.Push(lua.LString(luaAssetCheck(l).mimeType))
 	return 1
@@ -436,18 +615,18 @@ func luaAssetFnGetSize(l *lua.LState) int {
 }
 
 func luaAssetFnToString(l *lua.LState) int {
-	l.Push(lua.LString(string(luaAssetRead(luaAssetCheck(l)))))
+	l.Push(lua.LString(string(readAsset(luaAssetCheck(l)))))
 	return 1
 }
 
 func luaAssetFnTemplate(l *lua.LState) int {
-	asset, data := luaAssetCheck(l), l.CheckTable(2)
-	s := string(luaAssetRead(asset))
+	a, data := luaAssetCheck(l), l.CheckTable(2)
+	s := string(readAsset(a))
 	if yams.IsBinaryString(s) {
 		l.RaiseError("template() function is not available for binary assets")
 	}
 	buf := bytes.NewBuffer(nil)
-	t := template.Must(template.New(asset.path).Parse(s))
+	t := template.Must(template.New(a.path).Parse(s))
 	if err := t.Execute(buf, luaScriptValueMarshal(data)); err != nil {
 		panic(err)
 	}
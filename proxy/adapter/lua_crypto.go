@@ -0,0 +1,146 @@
+package adapter
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/lokhman/yams-lua"
+)
+
+func (s *luaScript) cryptoLoader(l *lua.LState) int {
+	mod := l.NewTable()
+	l.SetFuncs(mod, map[string]lua.LGFunction{
+		"md5":     luaCryptoDigest(crypto.MD5),
+		"sha1":    luaCryptoDigest(crypto.SHA1),
+		"sha256":  luaCryptoDigest(crypto.SHA256),
+		"sha512":  luaCryptoDigest(crypto.SHA512),
+		"hmac":    luaCryptoFnHMAC,
+		"random":  luaCryptoFnRandom,
+		"hex":     luaCryptoFnHex,
+		"unhex":   luaCryptoFnUnhex,
+		"equal":   luaCryptoFnEqual,
+		"encrypt": luaCryptoFnEncrypt,
+		"decrypt": luaCryptoFnDecrypt,
+		"sign":    s.fnCryptoSign,
+		"verify":  s.fnCryptoVerify,
+	})
+	l.Push(mod)
+	return 1
+}
+
+func luaCryptoHash(l *lua.LState, n int) crypto.Hash {
+	h, err := cryptoHash(l.OptString(n, "sha256"))
+	if err != nil {
+		l.ArgError(n, err.Error())
+	}
+	return h
+}
+
+// Pushes binary result with encoding from the argument n.
+func luaCryptoPush(l *lua.LState, n int, b []byte) int {
+	s, err := cryptoEncode(b, l.OptString(n, "hex"))
+	if err != nil {
+		l.ArgError(n, err.Error())
+	}
+	l.Push(lua.LString(s))
+	return 1
+}
+
+func luaCryptoDigest(h crypto.Hash) lua.LGFunction {
+	return func(l *lua.LState) int {
+		return luaCryptoPush(l, 2, cryptoDigest(h, []byte(l.CheckString(1))))
+	}
+}
+
+func luaCryptoFnHMAC(l *lua.LState) int {
+	h, err := cryptoHash(l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return luaCryptoPush(l, 4, cryptoHMAC(h, []byte(l.CheckString(2)), []byte(l.CheckString(3))))
+}
+
+func luaCryptoFnRandom(l *lua.LState) int {
+	b, err := cryptoRandom(l.CheckInt(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return luaCryptoPush(l, 2, b)
+}
+
+func luaCryptoFnHex(l *lua.LState) int {
+	l.Push(lua.LString(hex.EncodeToString([]byte(l.CheckString(1)))))
+	return 1
+}
+
+func luaCryptoFnUnhex(l *lua.LState) int {
+	b, err := hex.DecodeString(l.CheckString(1))
+	if err != nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+	l.Push(lua.LString(b))
+	return 1
+}
+
+func luaCryptoFnEqual(l *lua.LState) int {
+	a, b := l.CheckString(1), l.CheckString(2)
+	l.Push(lua.LBool(subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1))
+	return 1
+}
+
+func luaCryptoFnEncrypt(l *lua.LState) int {
+	b, err := cryptoEncrypt([]byte(l.CheckString(1)), []byte(l.CheckString(2)))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return luaCryptoPush(l, 3, b)
+}
+
+func luaCryptoFnDecrypt(l *lua.LState) int {
+	key := []byte(l.CheckString(1))
+	data, err := cryptoDecode(l.CheckString(2), l.OptString(3, "hex"))
+	if err == nil {
+		data, err = cryptoDecrypt(key, data)
+	}
+	if err != nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+	l.Push(lua.LString(data))
+	return 1
+}
+
+func (s *luaScript) fnCryptoSign(l *lua.LState) int {
+	key, err := s.keys.load(s.route.Profile.Id, l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	sig, err := cryptoSign(key, luaCryptoHash(l, 3), []byte(l.CheckString(2)))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	return luaCryptoPush(l, 4, sig)
+}
+
+func (s *luaScript) fnCryptoVerify(l *lua.LState) int {
+	key, err := s.keys.load(s.route.Profile.Id, l.CheckString(1))
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	data, h := []byte(l.CheckString(2)), luaCryptoHash(l, 4)
+	sig, err := cryptoDecode(l.CheckString(3), l.OptString(5, "hex"))
+	if err != nil {
+		l.Push(lua.LFalse)
+		return 1
+	}
+	ok, err := cryptoVerify(key, h, data, sig)
+	if err != nil {
+		l.ArgError(1, err.Error())
+	}
+	l.Push(lua.LBool(ok))
+	return 1
+}
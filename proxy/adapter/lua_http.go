@@ -0,0 +1,99 @@
+package adapter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lokhman/yams-lua"
+)
+
+func (s *luaScript) httpLoader(l *lua.LState) *lua.LTable {
+	t := l.NewTable()
+	l.SetFuncs(t, map[string]lua.LGFunction{
+		"request": s.fnHTTPRequest,
+		"get":     s.fnHTTPGet,
+		"post":    s.fnHTTPPost,
+	})
+	return t
+}
+
+// Converts table of header values, which are strings or lists of strings.
+func luaHeader(t *lua.LTable) http.Header {
+	h := make(http.Header)
+	t.ForEach(func(k, v lua.LValue) {
+		if vv, ok := v.(*lua.LTable); ok {
+			vv.ForEach(func(_, v lua.LValue) {
+				h.Add(k.String(), v.String())
+			})
+		} else {
+			h.Add(k.String(), v.String())
+		}
+	})
+	return h
+}
+
+func luaHTTPResponse(l *lua.LState, res *httpResponse) *lua.LTable {
+	t := l.CreateTable(0, 3)
+	t.RawSetString("status", lua.LNumber(res.Status))
+	h := l.CreateTable(0, len(res.Header))
+	for k, vv := range res.Header {
+		h.RawSetString(k, luaStringList(l, vv))
+	}
+	t.RawSetString("headers", h)
+	t.RawSetString("body", lua.LString(res.Body))
+	return t
+}
+
+// Sends the request and returns response, or nil and error message.
+func (s *luaScript) httpDo(l *lua.LState, r *httpRequest) int {
+	if err := r.check(s.route.Profile.HTTPAllowlist); err != nil {
+		l.RaiseError(err.Error())
+	}
+	res, err := r.do(l.Context(), s.route.Profile.HTTPAllowlist)
+	if err != nil {
+		l.Push(lua.LNil)
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+	l.Push(luaHTTPResponse(l, res))
+	return 1
+}
+
+func (s *luaScript) fnHTTPRequest(l *lua.LState) int {
+	t := l.CheckTable(1)
+	r := &httpRequest{Method: http.MethodGet}
+	if v, ok := t.RawGetString("method").(lua.LString); ok {
+		r.Method = string(v)
+	}
+	if v, ok := t.RawGetString("url").(lua.LString); ok {
+		r.URL = string(v)
+	} else {
+		l.ArgError(1, "url must be a string")
+	}
+	if v, ok := t.RawGetString("headers").(*lua.LTable); ok {
+		r.Header = luaHeader(v)
+	}
+	if v := t.RawGetString("body"); v != lua.LNil {
+		r.Body = v.String()
+	}
+	if v, ok := t.RawGetString("timeout").(lua.LNumber); ok {
+		r.Timeout = time.Duration(float64(v) * float64(time.Second))
+	}
+	return s.httpDo(l, r)
+}
+
+func (s *luaScript) fnHTTPGet(l *lua.LState) int {
+	r := &httpRequest{Method: http.MethodGet, URL: l.CheckString(1)}
+	if t := l.OptTable(2, nil); t != nil {
+		r.Header = luaHeader(t)
+	}
+	return s.httpDo(l, r)
+}
+
+func (s *luaScript) fnHTTPPost(l *lua.LState) int {
+	r := &httpRequest{Method: http.MethodPost, URL: l.CheckString(1), Body: l.OptString(2, "")}
+	if t := l.OptTable(3, nil); t != nil {
+		r.Header = luaHeader(t)
+	}
+	return s.httpDo(l, r)
+}
@@ -0,0 +1,286 @@
+package adapter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lokhman/yams-lua"
+	"github.com/lokhman/yams-lua-json"
+	"github.com/lokhman/yams/yams"
+)
+
+const (
+	luaWSReadLimit    = 16 << 20
+	luaWSCloseTimeout = time.Second
+)
+
+var luaWSUpgrader = websocket.Upgrader{
+	// mocks are requested from any origin
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// luaWS is WebSocket connection upgraded by the script. Messages are read in
+// the background, and timers are fired while script waits for a message.
+type luaWS struct {
+	conn    *websocket.Conn
+	msgs    chan luaWSMessage
+	done    chan struct{}
+	timers  []*luaWSTimer
+	timerId int
+	code    int
+	closed  bool
+}
+
+type luaWSMessage struct {
+	typ  int
+	data []byte
+	err  error
+}
+
+type luaWSTimer struct {
+	id       int
+	at       time.Time
+	interval time.Duration
+	fn       *lua.LFunction
+}
+
+func (s *luaScript) wsLoader(l *lua.LState) *lua.LTable {
+	t := l.NewTable()
+	l.SetField(t, "requested", lua.LBool(yams.IsWebSocketRequest(s.req)))
+	l.SetFuncs(t, map[string]lua.LGFunction{
+		"upgrade":    s.fnWSUpgrade,
+		"receive":    s.fnWSReceive,
+		"send":       s.fnWSSend,
+		"close":      s.fnWSClose,
+		"settimer":   s.fnWSSetTimer,
+		"cleartimer": s.fnWSClearTimer,
+	})
+	return t
+}
+
+// Upgrades connection to WebSocket, if it was not upgraded yet.
+func (s *luaScript) wsUpgrade(l *lua.LState, protocol string) *luaWS {
+	if s.ws != nil {
+		return s.ws
+	}
+	if !yams.IsWebSocketRequest(s.req) {
+		l.RaiseError("request is not a WebSocket handshake")
+	}
+	s.checkCommitted(l)
+	s.committed = true
+
+	h := yams.CloneHeader(s.rw.Header())
+	if protocol != "" {
+		h.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	conn, err := luaWSUpgrader.Upgrade(s.rw, s.req, h)
+	if err != nil {
+		// handshake error is already sent to the client
+		l.RaiseError("websocket: %s", err.Error())
+	}
+	conn.SetReadLimit(luaWSReadLimit)
+
+	ws := &luaWS{conn: conn, msgs: make(chan luaWSMessage), done: make(chan struct{})}
+	go func() {
+		for {
+			typ, data, err := conn.ReadMessage()
+			select {
+			case ws.msgs <- luaWSMessage{typ, data, err}:
+			case <-ws.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	s.ws = ws
+	return ws
+}
+
+// Closes WebSocket connection when script is finished.
+func (ws *luaWS) finish() {
+	if !ws.closed {
+		ws.closed = true
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		ws.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(luaWSCloseTimeout))
+	}
+	close(ws.done)
+	ws.conn.Close()
+}
+
+func (ws *luaWS) nextTimer() *luaWSTimer {
+	var next *luaWSTimer
+	for _, t := range ws.timers {
+		if next == nil || t.at.Before(next.at) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (ws *luaWS) removeTimer(id int) {
+	for i, t := range ws.timers {
+		if t.id == id {
+			ws.timers = append(ws.timers[:i], ws.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Converts Lua value to WebSocket message data, encoding tables to JSON.
+func luaWSData(v lua.LValue) []byte {
+	switch v := v.(type) {
+	case *lua.LTable:
+		b, err := json.Encode(v)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	case *lua.LUserData:
+		if a, ok := v.Value.(*asset); ok {
+			return readAsset(a)
+		}
+	}
+	return []byte(v.String())
+}
+
+func (s *luaScript) fnWSUpgrade(l *lua.LState) int {
+	ws := s.wsUpgrade(l, l.OptString(1, ""))
+	l.Push(lua.LString(ws.conn.Subprotocol()))
+	return 1
+}
+
+func (s *luaScript) fnWSReceive(l *lua.LState) int {
+	ws := s.wsUpgrade(l, "")
+	if ws.code != 0 {
+		l.Push(lua.LNil)
+		l.Push(lua.LString("close"))
+		l.Push(lua.LNumber(ws.code))
+		return 3
+	}
+
+	var timeout <-chan time.Time
+	if d := l.OptNumber(1, 0); d > 0 {
+		t := time.NewTimer(time.Duration(float64(d) * float64(time.Second)))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for {
+		var fire <-chan time.Time
+		var tm *time.Timer
+		next := ws.nextTimer()
+		if next != nil {
+			tm = time.NewTimer(time.Until(next.at))
+			fire = tm.C
+		}
+
+		var msg luaWSMessage
+		var received, expired, fired bool
+		select {
+		case msg = <-ws.msgs:
+			received = true
+		case <-timeout:
+			expired = true
+		case <-fire:
+			fired = true
+		case <-l.Context().Done():
+		}
+		if tm != nil {
+			tm.Stop()
+		}
+
+		switch {
+		case received && msg.err != nil:
+			ws.code = websocket.CloseAbnormalClosure
+			if ce, ok := msg.err.(*websocket.CloseError); ok {
+				ws.code = ce.Code
+			}
+			l.Push(lua.LNil)
+			l.Push(lua.LString("close"))
+			l.Push(lua.LNumber(ws.code))
+			return 3
+		case received:
+			l.Push(lua.LString(msg.data))
+			if msg.typ == websocket.BinaryMessage {
+				l.Push(lua.LString("binary"))
+			} else {
+				l.Push(lua.LString("text"))
+			}
+			return 2
+		case expired:
+			l.Push(lua.LNil)
+			l.Push(lua.LString("timeout"))
+			return 2
+		case fired:
+			if next.interval > 0 {
+				next.at = next.at.Add(next.interval)
+			} else {
+				ws.removeTimer(next.id)
+			}
+			l.CallByParam(lua.P{Fn: next.fn, NRet: 0, Protect: false}, lua.LNumber(next.id))
+		default:
+			l.RaiseError(l.Context().Err().Error())
+		}
+	}
+}
+
+func (s *luaScript) fnWSSend(l *lua.LState) int {
+	ws := s.wsUpgrade(l, "")
+	data := luaWSData(l.CheckAny(1))
+	typ := websocket.TextMessage
+	if l.OptBool(2, false) {
+		typ = websocket.BinaryMessage
+	}
+	if ws.closed {
+		l.RaiseError("websocket connection is closed")
+	}
+	if err := ws.conn.WriteMessage(typ, data); err != nil {
+		l.RaiseError("client has disconnected")
+	}
+	return 0
+}
+
+func (s *luaScript) fnWSClose(l *lua.LState) int {
+	ws := s.wsUpgrade(l, "")
+	code, reason := l.OptInt(1, websocket.CloseNormalClosure), l.OptString(2, "")
+	if code < 1000 || code > 4999 {
+		l.ArgError(1, "code must be a valid close code [1000:4999]")
+	}
+	if len(reason) > 123 {
+		l.ArgError(2, "reason must not be longer than 123 bytes")
+	}
+	if !ws.closed {
+		ws.closed = true
+		msg := websocket.FormatCloseMessage(code, reason)
+		ws.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(luaWSCloseTimeout))
+	}
+	return 0
+}
+
+func (s *luaScript) fnWSSetTimer(l *lua.LState) int {
+	d, fn := l.CheckNumber(1), l.CheckFunction(2)
+	if d <= 0 {
+		l.ArgError(1, "interval must be positive")
+	}
+	ws := s.wsUpgrade(l, "")
+	ws.timerId++
+	t := &luaWSTimer{id: ws.timerId, fn: fn}
+	interval := time.Duration(float64(d) * float64(time.Second))
+	if l.OptBool(3, false) {
+		t.interval = interval
+	}
+	t.at = time.Now().Add(interval)
+	ws.timers = append(ws.timers, t)
+	l.Push(lua.LNumber(t.id))
+	return 1
+}
+
+func (s *luaScript) fnWSClearTimer(l *lua.LState) int {
+	if s.ws != nil {
+		s.ws.removeTimer(l.CheckInt(1))
+	}
+	return 0
+}
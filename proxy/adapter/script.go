@@ -0,0 +1,102 @@
+package adapter
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/lokhman/yams/yams"
+)
+
+// Limits memory of multipart forms, which are parsed by the scripts.
+const formMaxMemory = 64 << 20
+
+// asset is the profile asset, which data is loaded only when it is written.
+type asset struct {
+	id       int
+	path     string
+	mimeType string
+	size     int
+}
+
+// Finds profile asset by the path, or returns nil if it does not exist.
+func findAsset(pid int, path string) *asset {
+	a := &asset{path: path}
+	q := `SELECT id, mime_type, octet_length(data) FROM assets WHERE profile_id = $1 AND path = $2`
+	if err := yams.DB.QueryRow(q, pid, path).Scan(&a.id, &a.mimeType, &a.size); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		panic(err)
+	}
+	return a
+}
+
+// Writes asset data directly to Writer.
+func loadAsset(w io.Writer, a *asset) {
+	// data is copied, so connection is released before slow writes
+	var data []byte
+	if err := yams.DB.QueryRow(`SELECT data FROM assets WHERE id = $1`, a.id).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return
+		}
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func readAsset(a *asset) []byte {
+	buf := bytes.NewBuffer(nil)
+	loadAsset(buf, a)
+	return buf.Bytes()
+}
+
+// Returns JSON value of the variable and prolongs its lifetime, or returns nil
+// if variable is not set or expired. Variables of the session are read if sid
+// is given.
+func getVar(pid int, sid *string, key string) []byte {
+	var vb []byte
+	q := `SELECT value FROM storage WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3 AND expires_at > now()`
+	if err := yams.DB.QueryRow(q, pid, sid, key).Scan(&vb); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		panic(err)
+	}
+	q = `UPDATE storage SET expires_at = now()+(expires_at-updated_at) WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3`
+	if _, err := yams.DB.Exec(q, pid, sid, key); err != nil {
+		panic(err)
+	}
+	return vb
+}
+
+// Stores JSON value of the variable for lifetime in seconds, or deletes the
+// variable if value is nil.
+func setVar(pid int, sid *string, key string, value []byte, lifetime int) {
+	if value == nil {
+		q := `DELETE FROM storage WHERE profile_id = $1 AND sid IS NOT DISTINCT FROM $2 AND key = $3`
+		if _, err := yams.DB.Exec(q, pid, sid, key); err != nil {
+			panic(err)
+		}
+		return
+	}
+	q := `INSERT INTO storage (profile_id, sid, key, value, expires_at) VALUES ($1, $2, $3, $4, now() + $5 * INTERVAL '1 second') ON CONFLICT (COALESCE(sid, ''), profile_id, key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`
+	if _, err := yams.DB.Exec(q, pid, sid, key, value, lifetime); err != nil {
+		panic(err)
+	}
+}
+
+// Parses urlencoded or multipart form of the request, and returns its values.
+func parseForm(req *http.Request, mem int64) (url.Values, error) {
+	if mem > formMaxMemory {
+		return nil, fmt.Errorf("maxmemory value must be not higher than %d", formMaxMemory)
+	}
+	req.ParseMultipartForm(mem)
+	if req.MultipartForm != nil {
+		return req.MultipartForm.Value, nil
+	}
+	return req.PostForm, nil
+}
@@ -0,0 +1,86 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+func init() {
+	model.RegisterCompiler(yams.AdapterStatic, staticCompile)
+}
+
+func staticCompile(r *model.Route) (interface{}, error) {
+	return yams.ParseStatic([]byte(r.Script))
+}
+
+// staticResponse serves the route document as is, without script.
+type staticResponse struct {
+	route *model.Route
+	rw    http.ResponseWriter
+	req   *http.Request
+}
+
+func NewStaticResponse(r *model.Route, rw http.ResponseWriter, req *http.Request) *staticResponse {
+	return &staticResponse{route: r, rw: rw, req: req}
+}
+
+func (s *staticResponse) Execute() error {
+	sr, ok := s.route.Program.(*yams.StaticResponse)
+	if !ok {
+		var err error
+		if sr, err = yams.ParseStatic([]byte(s.route.Script)); err != nil {
+			return err
+		}
+	}
+
+	if sr.Delay > 0 {
+		ctx, cancel := context.WithTimeout(s.req.Context(), time.Duration(s.route.Timeout)*time.Second)
+		defer cancel()
+
+		t := time.NewTimer(time.Duration(sr.Delay) * time.Millisecond)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			if s.req.Context().Err() != nil {
+				return http.ErrAbortHandler
+			}
+			return errors.New("yams: static response delay exceeds route timeout")
+		}
+	}
+
+	var data []byte
+	if sr.Asset != "" {
+		var mimeType string
+		q := `SELECT data, mime_type FROM assets WHERE profile_id = $1 AND path = $2`
+		if err := yams.DB.QueryRow(q, s.route.Profile.Id, sr.Asset).Scan(&data, &mimeType); err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New(`yams: asset "` + sr.Asset + `" is not found`)
+			}
+			return err
+		}
+		if http.Header(sr.Headers).Get("Content-Type") == "" {
+			s.rw.Header().Set("Content-Type", mimeType)
+		}
+	} else {
+		data = []byte(sr.Body)
+	}
+
+	for k, vv := range sr.Headers {
+		s.rw.Header()[k] = append([]string(nil), vv...)
+	}
+	status := sr.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	s.rw.WriteHeader(status)
+	s.rw.Write(data)
+	return nil
+}
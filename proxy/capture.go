@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+// capture records request and response passed through the proxy, so they
+// can be stored to the journal or recorded as routes.
+type capture struct {
+	http.ResponseWriter
+	profile  *model.Profile
+	req      *http.Request
+	reqBody  limitedBuffer
+	resBody  limitedBuffer
+	header   http.Header
+	status   int
+	sid      string
+	backend  string
+	hijacked bool
+	start    time.Time
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.Len(); n > 0 {
+		if len(p) > n {
+			b.Buffer.Write(p[:n])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+type captureReader struct {
+	io.Reader
+	io.Closer
+}
+
+func newCapture(rw http.ResponseWriter, req *http.Request, p *model.Profile) *capture {
+	c := &capture{ResponseWriter: rw, profile: p, req: req, start: time.Now()}
+	c.reqBody.limit = yams.MaxJournalBodySize
+	c.resBody.limit = yams.MaxJournalBodySize
+	if p.IsRecording && maxRecordBodySize > c.resBody.limit {
+		c.resBody.limit = maxRecordBodySize
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = captureReader{io.TeeReader(req.Body, &c.reqBody), req.Body}
+	}
+	return c
+}
+
+func (c *capture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+		c.header = yams.CloneHeader(c.Header())
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.resBody.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *capture) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *capture) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("yams: unable to hijack response writer")
+	}
+	c.hijacked = true
+	return h.Hijack()
+}
+
+func (c *capture) SetProxied(backend string) {
+	c.backend = backend
+}
+
+// Journal rows waiting to be stored, further rows are dropped.
+const journalQueueSize = 1024
+
+var journalQueue = newQueue("journal", `INSERT INTO journal (profile_id, route_uuid, sid, method, host, uri, ip, req_headers, req_body, status, res_headers, res_body, is_intercepted, backend, duration) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`, journalQueueSize)
+
+func (c *capture) done(r *model.Route) {
+	if c.status == 0 && !c.hijacked {
+		c.status, c.header = http.StatusOK, yams.CloneHeader(c.Header())
+	}
+	if c.status == 0 && c.hijacked && yams.IsWebSocketRequest(c.req) {
+		c.status, c.header = http.StatusSwitchingProtocols, yams.CloneHeader(c.Header())
+	}
+
+	if c.profile.IsJournal {
+		c.journal(r)
+	}
+	if c.profile.IsRecording && c.backend != "" && !c.hijacked {
+		c.record()
+	}
+}
+
+// Stores request and response to the journal of the profile.
+func (c *capture) journal(r *model.Route) {
+	var uuid *string
+	if r != nil {
+		uuid = &r.UUID
+	}
+	var backend *string
+	if c.backend != "" {
+		backend = &c.backend
+	}
+	reqHeader, err := json.Marshal(c.req.Header)
+	if err != nil {
+		panic(err)
+	}
+	resHeader, err := json.Marshal(c.header)
+	if err != nil {
+		panic(err)
+	}
+
+	// only request body consumed by the handler is stored
+	journalQueue.push([]interface{}{
+		c.profile.Id, uuid, c.sid, c.req.Method, c.req.Host, c.req.URL.RequestURI(), yams.ClientIP(c.req),
+		reqHeader, journalBody(&c.reqBody), c.status, resHeader, journalBody(&c.resBody), r != nil && backend == nil, backend,
+		time.Since(c.start).Seconds() * 1000,
+	})
+}
+
+func journalBody(b *limitedBuffer) []byte {
+	if b.Len() > yams.MaxJournalBodySize {
+		return b.Bytes()[:yams.MaxJournalBodySize]
+	}
+	return b.Bytes()
+}
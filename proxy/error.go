@@ -17,23 +17,25 @@ const (
 
 type proxyError struct {
 	status int
+	debug  bool
 	String string
 	Route  *model.Route
 	Caller string
 }
 
-func perror(w http.ResponseWriter, status int, str string, r *model.Route, skip int) {
+// Writes proxy error, which is detailed with the debug page if debug is set.
+func perror(w http.ResponseWriter, status int, str string, r *model.Route, debug bool, skip int) {
 	var caller string
 	if yams.Debug {
 		if pc, file, line, ok := runtime.Caller(skip); ok {
 			caller = fmt.Sprintf("%s:%d (0x%x)", file, line, pc)
 		}
 	}
-	proxyError{status, str, r, caller}.write(w)
+	proxyError{status, debug, str, r, caller}.write(w)
 }
 
 func (pe proxyError) write(w http.ResponseWriter) {
-	if pe.Route != nil && !pe.Route.Profile.IsDebug {
+	if !pe.debug {
 		http.Error(w, fmt.Sprintf("%d %s", pe.status, http.StatusText(pe.status)), pe.status)
 		return
 	}
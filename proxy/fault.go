@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+const (
+	faultDripInterval = 100 * time.Millisecond
+	faultHangTimeout  = time.Minute
+)
+
+// faulter buffers response to apply faults, which break its delivery. Flushed
+// responses are streamed as is.
+type faulter struct {
+	http.ResponseWriter
+	req         *http.Request
+	fault       yams.Fault
+	status      int
+	body        bytes.Buffer
+	passthrough bool
+}
+
+// Injects profile and route faults into the request. Faults that replace the
+// response are served immediately, and false is returned. Faults that break
+// the response delivery are applied by the returned writer, if not nil.
+func injectFaults(rw http.ResponseWriter, req *http.Request, p *model.Profile, r *model.Route) (*faulter, bool) {
+	faults := p.Faults
+	if r != nil {
+		faults = append(append(yams.Faults(nil), p.Faults...), r.Faults...)
+	}
+
+	var fw *faulter
+	for _, f := range faults {
+		if !f.Roll() {
+			continue
+		}
+		if p.IsDebug {
+			rw.Header().Add(yams.ProxyHeaderFault, f.Type)
+		}
+
+		switch f.Type {
+		case yams.FaultTypeLatency:
+			if !faultSleep(req, f.Latency()) {
+				panic(http.ErrAbortHandler)
+			}
+		case yams.FaultTypeError:
+			status := f.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			perror(rw, status, "yams: injected error fault", r, p.IsDebug, skipError)
+			return nil, false
+		case yams.FaultTypeReset:
+			faultReset(rw)
+			return nil, false
+		case yams.FaultTypeHang:
+			d := time.Duration(f.Delay) * time.Millisecond
+			if d == 0 {
+				d = faultHangTimeout
+				if r != nil && r.Timeout > 0 {
+					d = time.Duration(r.Timeout) * time.Second
+				}
+			}
+			faultSleep(req, d)
+			panic(http.ErrAbortHandler)
+		default:
+			// the first response fault wins
+			if fw == nil {
+				fw = &faulter{ResponseWriter: rw, req: req, fault: f}
+			}
+		}
+	}
+	return fw, true
+}
+
+// Sleeps for the duration, and reports false if client has gone.
+func faultSleep(req *http.Request, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// Resets client connection, if possible, or aborts the response.
+func faultReset(rw http.ResponseWriter) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		// send RST instead of FIN
+		tc.SetLinger(0)
+	}
+	conn.Close()
+}
+
+func (fw *faulter) WriteHeader(status int) {
+	if fw.passthrough {
+		fw.ResponseWriter.WriteHeader(status)
+	} else if fw.status == 0 {
+		fw.status = status
+	}
+}
+
+func (fw *faulter) Write(b []byte) (int, error) {
+	if fw.passthrough {
+		return fw.ResponseWriter.Write(b)
+	}
+	if fw.status == 0 {
+		fw.status = http.StatusOK
+	}
+	return fw.body.Write(b)
+}
+
+func (fw *faulter) Flush() {
+	if !fw.passthrough {
+		fw.passthrough = true
+		if fw.status != 0 {
+			fw.ResponseWriter.WriteHeader(fw.status)
+			fw.ResponseWriter.Write(fw.body.Bytes())
+		}
+	}
+	fw.flushWriter()
+}
+
+func (fw *faulter) SetProxied(backend string) {
+	if pw, ok := fw.ResponseWriter.(yams.ProxiedWriter); ok {
+		pw.SetProxied(backend)
+	}
+}
+
+// Hijacked connections, e.g. WebSockets, are not buffered.
+func (fw *faulter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("yams: unable to hijack response writer")
+	}
+	fw.passthrough = true
+	return h.Hijack()
+}
+
+func (fw *faulter) SetRate(rate int, ttfb time.Duration) {
+	if tw, ok := fw.ResponseWriter.(yams.ThrottledWriter); ok {
+		tw.SetRate(rate, ttfb)
+	}
+}
+
+// Sends buffered response with the fault applied. True is returned if the
+// response must be aborted, so the outer writers are finished before.
+func (fw *faulter) finish() bool {
+	if fw.passthrough {
+		return false
+	}
+	fw.passthrough = true
+	if fw.status == 0 {
+		fw.status = http.StatusOK
+	}
+
+	body, h := fw.body.Bytes(), fw.Header()
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	switch fw.fault.Type {
+	case yams.FaultTypeTruncate:
+		size := fw.fault.Size
+		if size == 0 || size >= len(body) {
+			size = len(body) / 2
+		}
+		fw.ResponseWriter.WriteHeader(fw.status)
+		fw.ResponseWriter.Write(body[:size])
+		fw.flushWriter()
+		return true
+	case yams.FaultTypeDrip:
+		size, interval := fw.fault.Size, time.Duration(fw.fault.Delay)*time.Millisecond
+		if size == 0 {
+			size = 1
+		}
+		if interval == 0 {
+			interval = faultDripInterval
+		}
+		fw.ResponseWriter.WriteHeader(fw.status)
+		for len(body) > 0 {
+			n := size
+			if n > len(body) {
+				n = len(body)
+			}
+			fw.ResponseWriter.Write(body[:n])
+			fw.flushWriter()
+			if body = body[n:]; len(body) > 0 && !faultSleep(fw.req, interval) {
+				return true
+			}
+		}
+	case yams.FaultTypeChunked:
+		hj, ok := fw.ResponseWriter.(http.Hijacker)
+		if !ok {
+			return true
+		}
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			return true
+		}
+		defer conn.Close()
+
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", fw.status, http.StatusText(fw.status))
+		h.Write(buf)
+		buf.WriteString("\r\n")
+
+		// valid chunk followed by the chunk with invalid size
+		half := len(body) / 2
+		fmt.Fprintf(buf, "%x\r\n", half)
+		buf.Write(body[:half])
+		buf.WriteString("\r\nzz\r\n")
+		buf.Write(body[half:])
+		buf.Flush()
+	}
+	return false
+}
+
+func (fw *faulter) flushWriter() {
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
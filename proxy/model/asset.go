@@ -0,0 +1,76 @@
+package model
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"log"
+	"sync"
+
+	"github.com/lokhman/yams/graphql"
+	"github.com/lokhman/yams/openapi"
+	"github.com/lokhman/yams/yams"
+	"github.com/vektah/gqlparser/ast"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// profileAssets are loaded from the spec and the assets of the profile on
+// first use, so reloads of the cache do not fetch data of all assets.
+type profileAssets struct {
+	once          sync.Once
+	id            int
+	validator     *openapi.Validator
+	descriptors   *protoregistry.Files
+	graphQLSchema *ast.Schema
+	certificate   *tls.Certificate
+	clientCAs     *x509.CertPool
+}
+
+func (a *profileAssets) get() *profileAssets {
+	a.once.Do(a.load)
+	return a
+}
+
+func (a *profileAssets) load() {
+	q := `SELECT CASE WHEN is_validating THEN spec END, (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.descriptor_set), graphql_schema, (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.graphql_schema), (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.tls_cert), (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.tls_key), (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.client_ca) FROM profiles WHERE id = $1`
+	var spec, descriptors, schema, certPEM, keyPEM, caPEM []byte
+	var schemaPath *string
+	if err := yams.DB.QueryRow(q, a.id).Scan(&spec, &descriptors, &schemaPath, &schema, &certPEM, &keyPEM, &caPEM); err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		}
+		return
+	}
+
+	var err error
+	if spec != nil {
+		if d, err := openapi.Load(spec); err != nil {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		} else if a.validator, err = openapi.NewValidator(d); err != nil {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		}
+	}
+	if descriptors != nil {
+		if a.descriptors, err = yams.LoadDescriptorSet(descriptors); err != nil {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		}
+	}
+	if schema != nil {
+		if a.graphQLSchema, err = graphql.LoadSchema(*schemaPath, string(schema)); err != nil {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		}
+	}
+	if certPEM != nil && keyPEM != nil {
+		if cert, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			log.Printf(`yams: profile "%d": %v`, a.id, err)
+		} else {
+			a.certificate = &cert
+		}
+	}
+	if caPEM != nil {
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(caPEM) {
+			log.Printf(`yams: profile "%d": no certificates found in client CA bundle`, a.id)
+		}
+	}
+}
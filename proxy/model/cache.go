@@ -0,0 +1,309 @@
+package model
+
+import (
+	"crypto/tls"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lokhman/yams/yams"
+)
+
+const (
+	cacheChannel      = "yams_profiles"
+	cachePingInterval = 90 * time.Second
+	cacheMinReconnect = 10 * time.Second
+	cacheMaxReconnect = time.Minute
+)
+
+// Compiler prepares route script once per cache load, so the adapter does
+// not have to parse it on every request.
+type Compiler func(r *Route) (interface{}, error)
+
+var compilers = make(map[string]Compiler)
+
+func RegisterCompiler(adapter string, c Compiler) {
+	compilers[adapter] = c
+}
+
+type cache struct {
+	sync.RWMutex
+	once     sync.Once
+	loading  sync.Mutex
+	loaded   bool
+	gen      uint64 // changed on every invalidation or refresh of the cache
+	profiles map[int]*Profile
+	hosts    map[string]*Profile
+	patterns []hostPattern
+}
+
+type hostPattern struct {
+	*yams.HostPattern
+	profile *Profile
+}
+
+var profileCache = &cache{}
+
+func (c *cache) lookup(host string) (*Profile, map[string]string, error) {
+	c.once.Do(func() {
+		go c.listen()
+	})
+
+	c.RLock()
+	if !c.loaded {
+		c.RUnlock()
+		if err := c.load(); err != nil {
+			return nil, nil, err
+		}
+		c.RLock()
+	}
+	defer c.RUnlock()
+
+	if p, ok := c.hosts[host]; ok {
+		return p, nil, nil
+	}
+	for _, hp := range c.patterns {
+		if params, ok := hp.Match(host); ok {
+			return hp.profile, params, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// Reloads profiles once for concurrent requests, which found cache invalid.
+func (c *cache) load() error {
+	c.loading.Lock()
+	defer c.loading.Unlock()
+
+	c.RLock()
+	loaded := c.loaded
+	c.RUnlock()
+	if loaded {
+		return nil
+	}
+	return c.reload()
+}
+
+func (c *cache) reload() error {
+	c.RLock()
+	gen := c.gen
+	c.RUnlock()
+
+	ps, err := fetchProfiles(nil)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for id := range c.profiles {
+		if _, ok := ps[id]; !ok {
+			yams.RemoveBalancer(id)
+		}
+	}
+	c.profiles = make(map[int]*Profile, len(ps))
+	c.hosts = make(map[string]*Profile)
+	c.patterns = nil
+	for _, p := range ps {
+		c.add(p)
+	}
+	c.sort()
+	// profiles might have been changed while they were fetched
+	c.loaded = c.gen == gen
+	return nil
+}
+
+func (c *cache) refresh(id int) error {
+	c.Lock()
+	// reload in progress might have fetched the profile before the change
+	c.gen++
+	loaded := c.loaded
+	c.Unlock()
+	if !loaded {
+		return nil
+	}
+
+	ps, err := fetchProfiles(&id)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.loaded {
+		return nil
+	}
+	if _, ok := ps[id]; !ok {
+		yams.RemoveBalancer(id)
+	}
+	if p, ok := c.profiles[id]; ok {
+		for _, host := range p.hosts {
+			delete(c.hosts, host)
+		}
+		patterns := c.patterns[:0]
+		for _, hp := range c.patterns {
+			if hp.profile != p {
+				patterns = append(patterns, hp)
+			}
+		}
+		c.patterns = patterns
+		delete(c.profiles, id)
+	}
+	for _, p := range ps {
+		c.add(p)
+	}
+	c.sort()
+	return nil
+}
+
+func (c *cache) invalidate() {
+	c.Lock()
+	c.gen++
+	c.loaded = false
+	c.Unlock()
+}
+
+func (c *cache) add(p *Profile) {
+	c.profiles[p.Id] = p
+	for _, host := range p.hosts {
+		hp, err := yams.ParseHost(host)
+		if err != nil {
+			log.Printf(`yams: profile "%d": %v`, p.Id, err)
+			continue
+		}
+		if hp.IsPattern() {
+			c.patterns = append(c.patterns, hostPattern{hp, p})
+		} else {
+			c.hosts[host] = p
+		}
+	}
+}
+
+// Orders host patterns so the most specific one wins.
+func (c *cache) sort() {
+	sort.SliceStable(c.patterns, func(i, j int) bool {
+		si, sj := c.patterns[i].Specificity(), c.patterns[j].Specificity()
+		if si != sj {
+			return si > sj
+		}
+		return c.patterns[i].Host < c.patterns[j].Host
+	})
+}
+
+func (c *cache) listen() {
+	l := pq.NewListener(yams.DSN, cacheMinReconnect, cacheMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("yams: cache listener: %v", err)
+		}
+		if ev == pq.ListenerEventConnected || ev == pq.ListenerEventReconnected {
+			// notifications might have been lost while disconnected
+			c.invalidate()
+		}
+	})
+	if err := l.Listen(cacheChannel); err != nil {
+		log.Printf("yams: cache listener: %v", err)
+	}
+
+	for {
+		select {
+		case n := <-l.Notify:
+			if n == nil {
+				c.invalidate()
+				continue
+			}
+			id, err := strconv.Atoi(n.Extra)
+			if err != nil {
+				continue
+			}
+			if err = c.refresh(id); err != nil {
+				log.Printf("yams: cache refresh: %v", err)
+				c.invalidate()
+			}
+		case <-time.After(cachePingInterval):
+			go l.Ping()
+		}
+	}
+}
+
+// Loads profiles with enabled routes, or a single profile if id is given.
+func fetchProfiles(id *int) (map[int]*Profile, error) {
+	q := `SELECT id, hosts, backends, balancing, is_debug, is_journal, is_recording, vars_lifetime, validation_status, faults, bandwidth, ttfb, client_auth, upstream, (SELECT data FROM assets WHERE profile_id = profiles.id AND path = profiles.upstream->>'ca'), http_allowlist FROM profiles WHERE $1::integer IS NULL OR id = $1`
+	rows, err := yams.DB.Query(q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ps := make(map[int]*Profile)
+	for rows.Next() {
+		var hosts, allowlist pq.StringArray
+		var upstreamCA []byte
+		var clientAuth *string
+		var backends yams.Backends
+		var balancing yams.Balancing
+		p := &Profile{Upstream: &yams.Upstream{}}
+		if err = rows.Scan(&p.Id, &hosts, &backends, &balancing, &p.IsDebug, &p.IsJournal, &p.IsRecording, &p.VarsLifetime, &p.ValidationStatus, &p.Faults, &p.Bandwidth, &p.TTFB, &clientAuth, p.Upstream, &upstreamCA, &allowlist); err != nil {
+			return nil, err
+		}
+		p.hosts, p.assets = hosts, &profileAssets{id: p.Id}
+		if clientAuth != nil {
+			switch *clientAuth {
+			case "request":
+				p.ClientAuth = tls.RequestClientCert
+			case "require":
+				p.ClientAuth = tls.RequireAnyClientCert
+			}
+		}
+		p.Upstream.CAData = upstreamCA
+		if p.HTTPAllowlist, err = yams.ParseHostList(allowlist); err != nil {
+			log.Printf(`yams: profile "%d": %v`, p.Id, err)
+		}
+		p.Balancer = yams.GetBalancer(p.Id, backends, balancing, p.Upstream)
+		ps[p.Id] = p
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	q = `SELECT profile_id, uuid, methods, path, conditions, adapter, script, timeout, faults, bandwidth, ttfb FROM routes WHERE ($1::integer IS NULL OR profile_id = $1) AND is_enabled = TRUE ORDER BY profile_id, position`
+	if rows, err = yams.DB.Query(q, id); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pid int
+		var methods pq.StringArray
+		r := &Route{}
+		if err = rows.Scan(&pid, &r.UUID, &methods, &r.Path, &r.conditions, &r.Adapter, &r.Script, &r.Timeout, &r.Faults, &r.Bandwidth, &r.TTFB); err != nil {
+			return nil, err
+		}
+		p, ok := ps[pid]
+		if !ok {
+			continue
+		}
+		if r.pattern, err = yams.ParsePath(r.Path); err != nil {
+			log.Printf(`yams: route "%s": %v`, r.UUID, err)
+			continue
+		}
+		if err = r.conditions.Compile(); err != nil {
+			log.Printf(`yams: route "%s": %v`, r.UUID, err)
+			continue
+		}
+		r.Profile, r.methods = p, methods
+		if compile, ok := compilers[r.Adapter]; ok {
+			// on error adapter will report it in runtime
+			r.Program, _ = compile(r)
+		}
+		p.routes = append(p.routes, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
@@ -1,32 +1,132 @@
 package model
 
 import (
-	"database/sql"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"strings"
 
+	"github.com/lokhman/yams/openapi"
 	"github.com/lokhman/yams/yams"
+	"github.com/vektah/gqlparser/ast"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 type Profile struct {
-	Id           int
-	Host         string
-	Backend      *string
-	IsDebug      bool
-	VarsLifetime int
+	Id               int
+	Host             string
+	IsDebug          bool
+	IsJournal        bool
+	IsRecording      bool
+	VarsLifetime     int
+	ValidationStatus *int
+	Faults           yams.Faults
+	Bandwidth        *int
+	TTFB             *int
+	HostParams       map[string]string
+
+	// ClientAuth requests or requires client certificates, which are
+	// verified with ClientCAs loaded from the trusted CA bundle asset.
+	ClientAuth tls.ClientAuthType
+
+	// Upstream configures requests passed to the backend.
+	Upstream *yams.Upstream
+
+	// HTTPAllowlist limits hosts, which are requested by the scripts.
+	HTTPAllowlist yams.HostList
+
+	// Balancer selects one of the profile backends, or is nil if profile
+	// has no backends.
+	Balancer *yams.Balancer
+
+	hosts  []string
+	routes []*Route
+	assets *profileAssets
+}
+
+// Validator is returned if profile validates requests against OpenAPI spec.
+func (p *Profile) Validator() *openapi.Validator {
+	return p.assets.get().validator
+}
+
+// Descriptors are loaded from the descriptor set asset for gRPC routes.
+func (p *Profile) Descriptors() *protoregistry.Files {
+	return p.assets.get().descriptors
+}
+
+// GraphQLSchema is loaded from the schema asset for GraphQL routes.
+func (p *Profile) GraphQLSchema() *ast.Schema {
+	return p.assets.get().graphQLSchema
+}
+
+// Certificate is loaded from the certificate and key assets for TLS,
+// otherwise it is issued by the local CA.
+func (p *Profile) Certificate() *tls.Certificate {
+	return p.assets.get().certificate
 }
 
-func MatchProfile(host string) *Profile {
+// ClientCAs are loaded from the trusted CA bundle asset.
+func (p *Profile) ClientCAs() *x509.CertPool {
+	return p.assets.get().clientCAs
+}
+
+// MatchProfile returns profile for the host, or nil if no profile is
+// configured. Error is returned if profiles cannot be loaded.
+func MatchProfile(host string) (*Profile, error) {
 	// allow HTTP and HTTPS by default
 	host = strings.TrimSuffix(host, ":80")
 	host = strings.TrimSuffix(host, ":443")
 
-	p := &Profile{Host: host}
-	q := `SELECT id, backend, is_debug, vars_lifetime FROM profiles WHERE $1 = ANY(hosts)`
-	if err := yams.DB.QueryRow(q, host).Scan(&p.Id, &p.Backend, &p.IsDebug, &p.VarsLifetime); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
+	cp, params, err := profileCache.lookup(strings.ToLower(host))
+	if cp == nil {
+		return nil, err
+	}
+	p := *cp
+	p.Host, p.HostParams = host, params
+	return &p, nil
+}
+
+// MatchTLSConfig returns TLS configuration of the profile for server name
+// with its certificate and client authentication.
+func MatchTLSConfig(serverName string) (*tls.Config, error) {
+	host := strings.ToLower(serverName)
+	p, _, err := profileCache.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, errors.New("yams: no profile configured for host")
+	}
+	cert := p.Certificate()
+	if cert == nil {
+		ca, err := yams.LocalCA()
+		if err != nil {
+			return nil, err
+		}
+		if cert, err = ca.Issue(host); err != nil {
+			return nil, err
+		}
+	}
+	// HTTP/2 connections cannot be hijacked for timeouts and faults, so it
+	// is negotiated only if profile serves gRPC
+	protos := []string{"http/1.1"}
+	if p.servesGRPC() {
+		protos = append([]string{"h2"}, protos...)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		NextProtos:   protos,
+		// certificates are verified by the scripts, so they can be rejected
+		ClientAuth: p.ClientAuth,
+		ClientCAs:  p.ClientCAs(),
+	}, nil
+}
+
+func (p *Profile) servesGRPC() bool {
+	for _, r := range p.routes {
+		if r.Adapter == yams.AdapterGRPC {
+			return true
 		}
-		panic(err)
 	}
-	return p
+	return false
 }
@@ -1,10 +1,13 @@
 package model
 
 import (
-	"database/sql"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"strconv"
 
-	"github.com/lib/pq"
 	"github.com/lokhman/yams/yams"
 )
 
@@ -16,7 +19,17 @@ type Route struct {
 	Adapter   string
 	Script    string
 	Timeout   int
+	Faults    yams.Faults
+	Bandwidth *int
+	TTFB      *int
 	Args      map[string]string
+
+	// Program is the script compiled by the adapter, if supported.
+	Program interface{}
+
+	methods    []string
+	pattern    *yams.PathPattern
+	conditions yams.RouteConditions
 }
 
 func (r Route) Debug() [][2]string {
@@ -27,21 +40,56 @@ func (r Route) Debug() [][2]string {
 	}
 }
 
-func MatchRoute(p *Profile, method, path string) *Route {
-	var pk, pv pq.StringArray
-	r := &Route{Profile: p, Method: method}
+func (r Route) PathArgs() []yams.PathArg {
+	return r.pattern.Args
+}
 
-	q := `SELECT uuid, path, path_args, regexp_matches($3, path_re), adapter, script, timeout FROM routes WHERE profile_id = $1 AND methods && $2 AND $3 ~ path_re AND is_enabled = TRUE ORDER BY position LIMIT 1`
-	if err := yams.DB.QueryRow(q, p.Id, pq.StringArray{method, "*"}, path).Scan(&r.UUID, &r.Path, &pk, &pv, &r.Adapter, &r.Script, &r.Timeout); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
+func MatchRoute(p *Profile, req *http.Request) *Route {
+	var body interface{}
+	var read bool
+	readBody := func() interface{} {
+		if !read {
+			read = true
+			body = decodeBody(req)
+		}
+		return body
+	}
+
+	for _, cr := range p.routes {
+		if !yams.InStringSlice(cr.methods, req.Method) && !yams.InStringSlice(cr.methods, "*") {
+			continue
+		}
+		pv := cr.pattern.Regexp.FindStringSubmatch(req.URL.Path)
+		if pv == nil || !cr.conditions.Match(req, readBody) {
+			continue
 		}
-		panic(err)
+
+		r := *cr
+		r.Profile, r.Method = p, req.Method
+		r.Args = make(map[string]string)
+		for i, arg := range r.pattern.Args {
+			r.Args[arg.Name] = pv[i+1]
+		}
+		return &r
+	}
+	return nil
+}
+
+// Decodes JSON request body and restores it for further reading.
+func decodeBody(req *http.Request) interface{} {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, yams.MaxConditionBodySize))
+	req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), req.Body))
+	if err != nil {
+		// e.g. client has gone, so the error is left to the handler
+		return nil
 	}
 
-	r.Args = make(map[string]string)
-	for i, key := range pk {
-		r.Args[key] = pv[i]
+	var v interface{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return nil
 	}
-	return r
+	return v
 }
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+
+	"github.com/lokhman/yams/yams"
+)
+
+// queue inserts rows to the database in background. Number of pending rows is
+// limited, so rows are dropped instead of piling up when database is slow.
+type queue struct {
+	name  string
+	query string
+	rows  chan []interface{}
+	once  sync.Once
+}
+
+func newQueue(name, query string, size int) *queue {
+	return &queue{name: name, query: query, rows: make(chan []interface{}, size)}
+}
+
+func (q *queue) push(args []interface{}) {
+	q.once.Do(func() { go q.run() })
+	select {
+	case q.rows <- args:
+	default:
+		log.Printf("yams: %s: queue is full, row is dropped", q.name)
+	}
+}
+
+func (q *queue) run() {
+	for args := range q.rows {
+		if _, err := yams.DB.Exec(q.query, args...); err != nil {
+			log.Printf("yams: %s: %v", q.name, err)
+		}
+	}
+}
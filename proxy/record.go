@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Limits response body buffered for the recording, larger responses are not
+// recorded.
+const maxRecordBodySize = 1 << 20 // 1MB
+
+// Recordings waiting to be stored, further recordings are dropped.
+const recordQueueSize = 64
+
+var recordQueue = newQueue("record", `INSERT INTO recordings (profile_id, method, path, query, status, headers, body) VALUES ($1, $2, $3, $4, $5, $6, $7)`, recordQueueSize)
+
+// Stores backend response, so it can be later converted to the route.
+func (c *capture) record() {
+	if c.resBody.Len() >= c.resBody.limit {
+		log.Printf(`yams: record: response body of "%s" exceeds %d bytes`, c.req.URL.Path, c.resBody.limit)
+		return
+	}
+
+	header, err := json.Marshal(c.header)
+	if err != nil {
+		panic(err)
+	}
+
+	recordQueue.push([]interface{}{c.profile.Id, c.req.Method, c.req.URL.Path, c.req.URL.RawQuery, c.status, header, c.resBody.Bytes()})
+}
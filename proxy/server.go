@@ -1,46 +1,110 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/lokhman/yams/proxy/adapter"
 	"github.com/lokhman/yams/proxy/model"
 	"github.com/lokhman/yams/yams"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const sidLength = 24
 
 var Server = &http.Server{
-	Addr:    yams.ProxyAddr,
-	Handler: &handler{},
+	Addr: yams.ProxyAddr,
+	// gRPC clients connect with HTTP/2 without TLS
+	Handler: h2c.NewHandler(&handler{}, &http2.Server{}),
+}
+
+// TLSServer serves HTTPS with certificates of the profiles, selected by SNI.
+var TLSServer = &http.Server{
+	Addr:      yams.ProxyTLSAddr,
+	Handler:   &handler{},
+	TLSConfig: &tls.Config{GetConfigForClient: getTLSConfig},
+}
+
+func getTLSConfig(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	serverName := hello.ServerName
+	if serverName == "" && hello.Conn != nil {
+		// clients do not send SNI for IP addresses
+		serverName, _, _ = net.SplitHostPort(hello.Conn.LocalAddr().String())
+	}
+	return model.MatchTLSConfig(serverName)
 }
 
 type handler struct{}
 
 func (s *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	var r *model.Route
+	var cw *capture
+	var fw *faulter
+	var vw *validator
+	var tw *throttle
 
 	defer (func() {
+		if cw != nil {
+			defer cw.done(r)
+		}
 		if err := recover(); err != nil {
-			perror(rw, http.StatusInternalServerError, fmt.Sprintf("%v", err), r, skipPanic)
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			perror(rw, http.StatusInternalServerError, fmt.Sprintf("%v", err), r, r == nil || r.Profile.IsDebug, skipPanic)
+		}
+		if vw != nil {
+			vw.flush()
+		}
+		abort := false
+		if fw != nil {
+			abort = fw.finish()
+		}
+		if tw != nil {
+			tw.finish()
+		}
+		if abort {
+			// response broken by the fault is aborted after writers are finished
+			panic(http.ErrAbortHandler)
 		}
 	})()
 
-	p := model.MatchProfile(req.Host)
+	p, err := model.MatchProfile(req.Host)
+	if err != nil {
+		perror(rw, http.StatusInternalServerError, fmt.Sprintf("yams: %v", err), nil, true, skipError)
+		return
+	}
 	if p == nil {
-		perror(rw, http.StatusNotFound, fmt.Sprintf(`yams: no profile configured for host "%s"`, req.Host), nil, skipError)
+		perror(rw, http.StatusNotFound, fmt.Sprintf(`yams: no profile configured for host "%s"`, req.Host), nil, true, skipError)
 		return
 	}
 
-	r = model.MatchRoute(p, req.Method, req.URL.Path)
+	if p.IsJournal || p.IsRecording {
+		cw = newCapture(rw, req, p)
+		rw = cw
+	}
+
+	r = model.MatchRoute(p, req)
 	if r == nil {
-		if p.Backend == nil {
-			perror(rw, http.StatusNotFound, fmt.Sprintf(`yams: no route found for path "%s"`, req.URL.Path), nil, skipError)
+		if p.Balancer == nil {
+			perror(rw, http.StatusNotFound, fmt.Sprintf(`yams: no route found for path "%s"`, req.URL.Path), nil, true, skipError)
 			return
 		}
-		yams.ReverseProxy(rw, req, *p.Backend, p.IsDebug)
+		tw = newThrottle(rw, req, p, nil)
+		rw = tw
+
+		var ok bool
+		if fw, ok = injectFaults(rw, req, p, nil); !ok {
+			return
+		}
+		if fw != nil {
+			rw = fw
+		}
+		p.Balancer.ReverseProxy(rw, req, p.Upstream, p.IsDebug)
 		return
 	}
 
@@ -51,6 +115,9 @@ func (s *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	if sid == "" {
 		sid = yams.RandString(sidLength)
 	}
+	if cw != nil {
+		cw.sid = sid
+	}
 
 	if r.Profile.IsDebug {
 		rw.Header().Set(yams.ProxyHeaderStatus, yams.ProxyStatusIntercepted)
@@ -59,32 +126,63 @@ func (s *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	if r.Timeout == 0 {
-		w, ok := rw.(http.Hijacker)
-		if !ok {
-			panic("yams: unable to hijack response writer")
+		if w, ok := rw.(http.Hijacker); ok {
+			if conn, buf, err := w.Hijack(); err == nil {
+				buf.Flush()
+				conn.Close()
+				return
+			}
 		}
-		conn, buf, err := w.Hijack()
-		if err != nil {
-			panic(err)
-		}
-		buf.Flush()
-		conn.Close()
+		// connection cannot be dropped, e.g. over HTTP/2, so the stream is reset
+		panic(http.ErrAbortHandler)
+	}
+
+	tw = newThrottle(rw, req, r.Profile, r)
+	rw = tw
+
+	var ok bool
+	if fw, ok = injectFaults(rw, req, r.Profile, r); !ok {
 		return
 	}
+	if fw != nil {
+		rw = fw
+	}
+
+	if r.Profile.Validator() != nil && r.Adapter != yams.AdapterGRPC {
+		if !validateRequest(rw, req, r) {
+			return
+		}
+		vw = newValidator(rw, req, r)
+		rw = vw
+	}
 
 	if req.URL.Scheme == "" {
-		// if scheme is passed by the proxy
-		req.URL.Scheme = req.Header.Get("X-Scheme")
+		if req.TLS != nil {
+			req.URL.Scheme = "https"
+		} else {
+			// if scheme is passed by the proxy
+			req.URL.Scheme = req.Header.Get("X-Scheme")
+		}
 	}
 
-	var err error
 	switch r.Adapter {
 	case yams.AdapterLua:
 		err = adapter.NewLuaScript(r, rw, req, sid).Execute()
+	case yams.AdapterGRPC:
+		err = adapter.NewGRPCScript(r, rw, req, sid).Execute()
+	case yams.AdapterGraphQL:
+		err = adapter.NewGraphQLScript(r, rw, req, sid).Execute()
+	case yams.AdapterJavaScript:
+		err = adapter.NewJSScript(r, rw, req, sid).Execute()
+	case yams.AdapterStatic:
+		err = adapter.NewStaticResponse(r, rw, req).Execute()
 	default:
 		panic(fmt.Sprintf(`yams: unknown adapter "%s"`, r.Adapter))
 	}
 	if err != nil {
 		panic(err)
 	}
+	if vw != nil {
+		vw.done()
+	}
 }
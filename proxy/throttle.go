@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+// Number of writes per second for throttled responses.
+const throttleTicks = 10
+
+// throttle limits bandwidth of the response and delays its first byte.
+type throttle struct {
+	http.ResponseWriter
+	req   *http.Request
+	rate  int
+	ttfb  time.Duration
+	start time.Time
+	sent  int
+	begun bool
+}
+
+// Creates throttled writer with route settings, which override profile ones.
+func newThrottle(rw http.ResponseWriter, req *http.Request, p *model.Profile, r *model.Route) *throttle {
+	t := &throttle{ResponseWriter: rw, req: req}
+	bandwidth, ttfb := p.Bandwidth, p.TTFB
+	if r != nil && r.Bandwidth != nil {
+		bandwidth = r.Bandwidth
+	}
+	if r != nil && r.TTFB != nil {
+		ttfb = r.TTFB
+	}
+	if bandwidth != nil {
+		t.rate = *bandwidth
+	}
+	if ttfb != nil {
+		t.ttfb = time.Duration(*ttfb) * time.Millisecond
+	}
+	return t
+}
+
+// SetRate overrides bandwidth in bytes per second, where 0 is unlimited, and
+// time to the first byte, if not negative and the response has not started.
+func (t *throttle) SetRate(rate int, ttfb time.Duration) {
+	t.rate, t.start, t.sent = rate, time.Now(), 0
+	if !t.begun && ttfb >= 0 {
+		t.ttfb = ttfb
+	}
+}
+
+func (t *throttle) begin() error {
+	if t.begun {
+		return nil
+	}
+	t.begun = true
+	if t.ttfb > 0 && !faultSleep(t.req, t.ttfb) {
+		return t.req.Context().Err()
+	}
+	t.start = time.Now()
+	return nil
+}
+
+// Delays the response, which was not written by the handler, e.g. empty
+// response with the default status.
+func (t *throttle) finish() {
+	t.begin()
+}
+
+func (t *throttle) WriteHeader(status int) {
+	t.begin()
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *throttle) Write(b []byte) (int, error) {
+	if err := t.begin(); err != nil {
+		return 0, err
+	}
+	if t.rate <= 0 {
+		return t.ResponseWriter.Write(b)
+	}
+
+	size := t.rate / throttleTicks
+	if size == 0 {
+		size = 1
+	}
+
+	var n int
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		m, err := t.ResponseWriter.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		t.Flush()
+
+		t.sent += m
+		d := time.Duration(float64(t.sent)/float64(t.rate)*float64(time.Second)) - time.Since(t.start)
+		if d > 0 && !faultSleep(t.req, d) {
+			return n, t.req.Context().Err()
+		}
+	}
+	return n, nil
+}
+
+func (t *throttle) Flush() {
+	t.begin()
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *throttle) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("yams: unable to hijack response writer")
+	}
+	// hijacked connections are not delayed
+	t.begun = true
+	return h.Hijack()
+}
+
+func (t *throttle) SetProxied(backend string) {
+	if pw, ok := t.ResponseWriter.(yams.ProxiedWriter); ok {
+		pw.SetProxied(backend)
+	}
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lokhman/yams/proxy/model"
+	"github.com/lokhman/yams/yams"
+)
+
+// validator buffers script response, so it can be checked against OpenAPI
+// spec of the profile before it is sent. Responses passed to the backend or
+// flushed by the script are not validated.
+type validator struct {
+	http.ResponseWriter
+	route       *model.Route
+	req         *http.Request
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	passthrough bool
+}
+
+// Validates request against OpenAPI spec of the profile, and reports if the
+// request may be served. Requests with body over MaxConditionBodySize are not
+// validated, as the body cannot be checked as a whole.
+func validateRequest(rw http.ResponseWriter, req *http.Request, r *model.Route) bool {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(io.LimitReader(req.Body, yams.MaxConditionBodySize+1)); err != nil {
+			panic(err)
+		}
+		req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+		if len(body) > yams.MaxConditionBodySize {
+			return true
+		}
+	}
+
+	vs := r.Profile.Validator().ValidateRequest(req, body)
+	if len(vs) == 0 {
+		return true
+	}
+	if r.Profile.IsDebug {
+		rw.Header()[yams.ProxyHeaderViolation] = vs
+	}
+	if r.Profile.ValidationStatus == nil {
+		return true
+	}
+	perror(rw, *r.Profile.ValidationStatus, strings.Join(vs, "\n"), r, r.Profile.IsDebug, skipError)
+	return false
+}
+
+func newValidator(rw http.ResponseWriter, req *http.Request, r *model.Route) *validator {
+	return &validator{ResponseWriter: rw, route: r, req: req, header: yams.CloneHeader(rw.Header())}
+}
+
+func (v *validator) WriteHeader(status int) {
+	if v.passthrough {
+		v.ResponseWriter.WriteHeader(status)
+	} else if v.status == 0 {
+		v.status = status
+	}
+}
+
+func (v *validator) Write(b []byte) (int, error) {
+	if v.passthrough {
+		return v.ResponseWriter.Write(b)
+	}
+	if v.status == 0 {
+		v.status = http.StatusOK
+	}
+	return v.body.Write(b)
+}
+
+func (v *validator) Flush() {
+	v.flush()
+	if f, ok := v.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (v *validator) SetProxied(backend string) {
+	v.flush()
+	if pw, ok := v.ResponseWriter.(yams.ProxiedWriter); ok {
+		pw.SetProxied(backend)
+	}
+}
+
+// Hijacked connections, e.g. WebSockets, are not buffered.
+func (v *validator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := v.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("yams: unable to hijack response writer")
+	}
+	v.passthrough = true
+	return h.Hijack()
+}
+
+func (v *validator) SetRate(rate int, ttfb time.Duration) {
+	if tw, ok := v.ResponseWriter.(yams.ThrottledWriter); ok {
+		tw.SetRate(rate, ttfb)
+	}
+}
+
+// Sends buffered response and switches to pass through mode.
+func (v *validator) flush() {
+	if v.passthrough {
+		return
+	}
+	v.passthrough = true
+	if v.status != 0 {
+		v.ResponseWriter.WriteHeader(v.status)
+		v.ResponseWriter.Write(v.body.Bytes())
+	}
+}
+
+// Validates buffered response and sends it. Violations are reported in debug
+// headers, and if profile rejects invalid requests, debug response is replaced
+// by the error page.
+func (v *validator) done() {
+	if v.passthrough {
+		return
+	}
+	status := v.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	p := v.route.Profile
+	vs := p.Validator().ValidateResponse(v.req, status, v.Header(), v.body.Bytes())
+	if len(vs) > 0 && p.IsDebug {
+		if p.ValidationStatus != nil {
+			h := v.Header()
+			for k := range h {
+				delete(h, k)
+			}
+			for k, vv := range v.header {
+				h[k] = vv
+			}
+			h[yams.ProxyHeaderViolation] = append(h[yams.ProxyHeaderViolation], vs...)
+			v.passthrough = true
+			perror(v.ResponseWriter, http.StatusInternalServerError, strings.Join(vs, "\n"), v.route, p.IsDebug, skipError)
+			return
+		}
+		h := v.Header()
+		h[yams.ProxyHeaderViolation] = append(h[yams.ProxyHeaderViolation], vs...)
+	}
+	v.flush()
+}
@@ -14,6 +14,11 @@ func main() {
 
 	var stack errgroup.Group
 	stack.Go(proxy.Server.ListenAndServe)
+	if proxy.TLSServer.Addr != "" {
+		stack.Go(func() error {
+			return proxy.TLSServer.ListenAndServeTLS("", "")
+		})
+	}
 	stack.Go(console.Server.ListenAndServe)
 
 	if err := stack.Wait(); err != nil {
@@ -1,7 +1,11 @@
 package yams
 
 const (
-	AdapterLua = "lua"
+	AdapterLua        = "lua"
+	AdapterGRPC       = "grpc"
+	AdapterGraphQL    = "graphql"
+	AdapterStatic     = "static"
+	AdapterJavaScript = "javascript"
 )
 
 type adapterMap map[string]string
@@ -16,7 +20,11 @@ func (am adapterMap) GetMimeType(adapter string) string {
 }
 
 var Adapters = adapterMap{
-	"application/x-lua": AdapterLua,
+	"application/x-lua":         AdapterLua,
+	"application/x-grpc-lua":    AdapterGRPC,
+	"application/x-graphql-lua": AdapterGraphQL,
+	"application/x-yams-static": AdapterStatic,
+	"application/javascript":    AdapterJavaScript,
 }
 
 const DefaultScript = `local yams = require("yams")
@@ -0,0 +1,379 @@
+package yams
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BalancingRoundRobin = "round_robin"
+	BalancingWeighted   = "weighted"
+	BalancingRandom     = "random"
+
+	balancerMaxFails       = 3
+	balancerEjectTime      = 30 // seconds
+	balancerHealthInterval = 10 // seconds
+	balancerMaxRetryBody   = 1 << 20
+)
+
+// Backend of the profile. Weight is used by the weighted balancing only.
+type Backend struct {
+	URL    string `json:"url" binding:"required,max=128,url"`
+	Weight int    `json:"weight,omitempty" binding:"omitempty,min=1,max=100"`
+}
+
+type Backends []Backend
+
+func (bs *Backends) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, bs)
+	case string:
+		return json.Unmarshal([]byte(v), bs)
+	case nil:
+		*bs = nil
+		return nil
+	}
+	return errors.New("yams: unsupported type for backends")
+}
+
+func (bs Backends) Value() (driver.Value, error) {
+	if bs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(bs)
+}
+
+// Balancing selects backends of the profile. Backend is ejected for
+// EjectTime seconds after MaxFails consecutive failures, and is checked with
+// GET request to HealthPath every HealthInterval seconds, if it is defined.
+type Balancing struct {
+	Strategy       string `json:"strategy,omitempty" binding:"omitempty,oneof=round_robin weighted random"`
+	MaxFails       int    `json:"max_fails,omitempty" binding:"omitempty,min=1,max=100"`
+	EjectTime      int    `json:"eject_time,omitempty" binding:"omitempty,min=1,max=86400"`
+	HealthPath     string `json:"health_path,omitempty" binding:"omitempty,max=128"`
+	HealthInterval int    `json:"health_interval,omitempty" binding:"omitempty,min=1,max=86400"`
+}
+
+func (b *Balancing) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, b)
+	case string:
+		return json.Unmarshal([]byte(v), b)
+	case nil:
+		*b = Balancing{}
+		return nil
+	}
+	return errors.New("yams: unsupported type for balancing")
+}
+
+func (b Balancing) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+// BackendState is the health of the backend, which is reported in console.
+type BackendState struct {
+	URL          string     `json:"url"`
+	Healthy      bool       `json:"healthy"`
+	Fails        int        `json:"fails"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+type balancerBackend struct {
+	BackendState
+	weight  int
+	current int // smooth weighted round-robin
+}
+
+func (be *balancerBackend) available(now time.Time) bool {
+	return be.EjectedUntil == nil || now.After(*be.EjectedUntil)
+}
+
+// Balancer selects backends of the profile and keeps their health between
+// profile reloads.
+type Balancer struct {
+	sync.Mutex
+	config   Balancing
+	upstream *Upstream
+	backends []*balancerBackend
+	next     int
+	stop     chan struct{}
+}
+
+var balancers = struct {
+	sync.Mutex
+	m map[int]*Balancer
+}{m: make(map[int]*Balancer)}
+
+// GetBalancer returns balancer of the profile with the given configuration,
+// or nil if the profile has no backends.
+func GetBalancer(pid int, bs Backends, config Balancing, up *Upstream) *Balancer {
+	balancers.Lock()
+	defer balancers.Unlock()
+
+	b := balancers.m[pid]
+	if len(bs) == 0 {
+		if b != nil {
+			b.close()
+			delete(balancers.m, pid)
+		}
+		return nil
+	}
+	if b == nil {
+		b = &Balancer{}
+		balancers.m[pid] = b
+	}
+	b.configure(bs, config, up)
+	return b
+}
+
+// RemoveBalancer stops health checks of the deleted profile.
+func RemoveBalancer(pid int) {
+	balancers.Lock()
+	defer balancers.Unlock()
+
+	if b, ok := balancers.m[pid]; ok {
+		b.close()
+		delete(balancers.m, pid)
+	}
+}
+
+// BalancerStates returns health of the profile backends, if they were used.
+func BalancerStates(pid int) []BackendState {
+	balancers.Lock()
+	b := balancers.m[pid]
+	balancers.Unlock()
+
+	if b == nil {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	states := make([]BackendState, len(b.backends))
+	for i, be := range b.backends {
+		states[i] = be.BackendState
+	}
+	return states
+}
+
+func (b *Balancer) configure(bs Backends, config Balancing, up *Upstream) {
+	if config.MaxFails == 0 {
+		config.MaxFails = balancerMaxFails
+	}
+	if config.EjectTime == 0 {
+		config.EjectTime = balancerEjectTime
+	}
+	if config.HealthInterval == 0 {
+		config.HealthInterval = balancerHealthInterval
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// health of the same backends is kept
+	old := make(map[string]*balancerBackend, len(b.backends))
+	for _, be := range b.backends {
+		old[be.URL] = be
+	}
+	b.backends = make([]*balancerBackend, len(bs))
+	for i, backend := range bs {
+		be, ok := old[backend.URL]
+		delete(old, backend.URL)
+		if !ok {
+			be = &balancerBackend{BackendState: BackendState{URL: backend.URL, Healthy: true}}
+		}
+		if be.weight = backend.Weight; be.weight == 0 {
+			be.weight = 1
+		}
+		b.backends[i] = be
+	}
+	b.config, b.upstream = config, up
+
+	b.close()
+	if config.HealthPath != "" {
+		b.stop = make(chan struct{})
+		go b.healthCheck(b.stop, time.Duration(config.HealthInterval)*time.Second)
+	}
+}
+
+// Stops health checks, must be called with the lock.
+func (b *Balancer) close() {
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// Returns backends in order of attempts: the selected one goes first and
+// others are used for failover. Ejected backends are used only if all
+// backends are ejected.
+func (b *Balancer) order() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	var available []*balancerBackend
+	for _, be := range b.backends {
+		if be.available(now) {
+			available = append(available, be)
+		}
+	}
+	if len(available) == 0 {
+		available = b.backends
+	}
+
+	var first int
+	switch b.config.Strategy {
+	case BalancingRandom:
+		first = rand.Intn(len(available))
+	case BalancingWeighted:
+		total := 0
+		for i, be := range available {
+			be.current += be.weight
+			total += be.weight
+			if be.current > available[first].current {
+				first = i
+			}
+		}
+		available[first].current -= total
+	default:
+		first = b.next % len(available)
+		b.next++
+	}
+
+	urls := make([]string, 0, len(available))
+	for i := range available {
+		urls = append(urls, available[(first+i)%len(available)].URL)
+	}
+	return urls
+}
+
+// Reports result of the request to the backend.
+func (b *Balancer) report(url string, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, be := range b.backends {
+		if be.URL != url {
+			continue
+		}
+		if err == nil {
+			be.Fails, be.Error, be.Healthy, be.EjectedUntil = 0, "", true, nil
+			return
+		}
+		be.Fails++
+		be.Error = err.Error()
+		if be.Fails >= b.config.MaxFails {
+			until := time.Now().Add(time.Duration(b.config.EjectTime) * time.Second)
+			be.Healthy, be.EjectedUntil = false, &until
+		}
+		return
+	}
+}
+
+func (b *Balancer) healthCheck(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.Lock()
+		path, up := b.config.HealthPath, b.upstream
+		urls := make([]string, len(b.backends))
+		for i, be := range b.backends {
+			urls[i] = be.URL
+		}
+		b.Unlock()
+
+		client := &http.Client{Transport: up.transport(), Timeout: interval}
+		for _, u := range urls {
+			err := checkBackend(client, strings.TrimSuffix(u, "/")+"/"+strings.TrimPrefix(path, "/"))
+
+			b.Lock()
+			now := time.Now()
+			for _, be := range b.backends {
+				if be.URL == u {
+					be.CheckedAt = &now
+					if err != nil {
+						until := now.Add(interval)
+						be.Healthy, be.EjectedUntil, be.Error = false, &until, err.Error()
+					} else if !be.Healthy && be.Fails < b.config.MaxFails {
+						be.Healthy, be.EjectedUntil, be.Error = true, nil, ""
+					}
+				}
+			}
+			b.Unlock()
+		}
+	}
+}
+
+func checkBackend(client *http.Client, url string) error {
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return errors.New("health check failed with status " + res.Status)
+	}
+	return nil
+}
+
+// ReverseProxy passes request to the selected backend, and fails over to the
+// next backends if the backend is not available. Error of the last backend is
+// returned.
+func (b *Balancer) ReverseProxy(w http.ResponseWriter, r *http.Request, up *Upstream, debug bool) error {
+	urls := b.order()
+
+	// request is retried only if its body can be replayed
+	var body []byte
+	retry := r.Body == nil || r.Body == http.NoBody
+	if !retry && r.ContentLength >= 0 && r.ContentLength <= balancerMaxRetryBody {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			panic(err)
+		}
+		retry = true
+	}
+
+	for i, u := range urls {
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		last := !retry || i == len(urls)-1
+		err := reverseProxy(w, r, u, up, debug, !last)
+		if r.Context().Err() != nil {
+			// client has gone away, backend is not blamed
+			return r.Context().Err()
+		}
+		b.report(u, err)
+		if err == nil || last {
+			return err
+		}
+	}
+	return nil
+}
+
+// errBackendStatus is reported for the responses of unavailable backend.
+var errBackendStatus = errors.New("backend responded with gateway error")
+
+func isBackendFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,239 @@
+package yams
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 397 * 24 * time.Hour // maximum accepted by browsers
+	certRenew    = 7 * 24 * time.Hour
+	certCacheMax = 1024 // hosts may be requested by any client with patterns
+)
+
+// CertAuthority is the local CA, which issues certificates for profile hosts
+// on the fly, so proxy can serve HTTPS without certificates of the hosts.
+type CertAuthority struct {
+	sync.Mutex
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  []byte
+
+	// issued certificates are evicted when cache is full, the least
+	// recently used first
+	certs map[string]*list.Element
+	lru   *list.List
+}
+
+type issuedCert struct {
+	host string
+	cert *tls.Certificate
+}
+
+var localCA struct {
+	sync.Once
+	ca  *CertAuthority
+	err error
+}
+
+// LocalCA loads the CA from the certificate and key files, which are
+// generated on the first use.
+func LocalCA() (*CertAuthority, error) {
+	localCA.Do(func() {
+		localCA.ca, localCA.err = LoadCA(CACertFile, CAKeyFile)
+	})
+	return localCA.ca, localCA.err
+}
+
+// LoadCA reads CA certificate and key in PEM format, or generates new CA if
+// both files do not exist.
+func LoadCA(certFile, keyFile string) (*CertAuthority, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if os.IsNotExist(err) {
+		if _, err = os.Stat(keyFile); os.IsNotExist(err) {
+			return generateCA(certFile, keyFile)
+		}
+		return nil, errors.New("yams: CA certificate file is missing")
+	} else if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, errors.New("yams: certificate is not a CA")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("yams: unsupported CA private key")
+	}
+	return newCA(cert, key, certPEM), nil
+}
+
+func generateCA(certFile, keyFile string) (*CertAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"YAMS"}, CommonName: "YAMS Local CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return nil, err
+	}
+	return newCA(cert, key, certPEM), nil
+}
+
+func newCA(cert *x509.Certificate, key crypto.Signer, certPEM []byte) *CertAuthority {
+	return &CertAuthority{cert: cert, key: key, pem: certPEM, certs: make(map[string]*list.Element), lru: list.New()}
+}
+
+// PEM returns CA certificate, which should be trusted by the clients.
+func (ca *CertAuthority) PEM() []byte {
+	return ca.pem
+}
+
+// Issue returns certificate for the host, which is cached until it expires
+// or is evicted by other hosts.
+func (ca *CertAuthority) Issue(host string) (*tls.Certificate, error) {
+	if c := ca.cached(host); c != nil {
+		return c, nil
+	}
+
+	// certificate is generated without the lock, so handshakes of other
+	// hosts are not blocked
+	c, err := ca.issue(host)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.Lock()
+	defer ca.Unlock()
+
+	if e, ok := ca.certs[host]; ok {
+		ca.lru.Remove(e)
+	}
+	ca.certs[host] = ca.lru.PushFront(&issuedCert{host, c})
+	for ca.lru.Len() > certCacheMax {
+		e := ca.lru.Back()
+		delete(ca.certs, e.Value.(*issuedCert).host)
+		ca.lru.Remove(e)
+	}
+	return c, nil
+}
+
+func (ca *CertAuthority) cached(host string) *tls.Certificate {
+	ca.Lock()
+	defer ca.Unlock()
+
+	if e, ok := ca.certs[host]; ok {
+		if c := e.Value.(*issuedCert).cert; time.Until(c.Leaf.NotAfter) > certRenew {
+			ca.lru.MoveToFront(e)
+			return c
+		}
+	}
+	return nil
+}
+
+func (ca *CertAuthority) issue(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"YAMS"}, CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tpl.IPAddresses = []net.IP{ip}
+	} else {
+		tpl.DNSNames = []string{host}
+	}
+	if tpl.NotAfter.After(ca.cert.NotAfter) {
+		tpl.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func randSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,71 @@
+package yams
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// ClientCert is the certificate presented by the client over TLS with the
+// result of its verification against trusted CA bundle of the profile.
+type ClientCert struct {
+	Subject     string
+	Issuer      string
+	Serial      string
+	DNSNames    []string
+	Emails      []string
+	IPs         []string
+	URIs        []string
+	Fingerprint string // SHA-256
+	NotBefore   int64
+	NotAfter    int64
+	Verified    bool
+	Error       string
+}
+
+// VerifyClientCert returns client certificate of the connection, or nil if
+// client has not presented any.
+func VerifyClientCert(state *tls.ConnectionState, roots *x509.CertPool) *ClientCert {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	cert := state.PeerCertificates[0]
+	sum := sha256.Sum256(cert.Raw)
+	cc := &ClientCert{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		Serial:      cert.SerialNumber.Text(16),
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		NotBefore:   cert.NotBefore.Unix(),
+		NotAfter:    cert.NotAfter.Unix(),
+	}
+	for _, ip := range cert.IPAddresses {
+		cc.IPs = append(cc.IPs, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		cc.URIs = append(cc.URIs, uri.String())
+	}
+
+	if roots == nil {
+		cc.Error = "no trusted CA bundle is configured"
+		return cc
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, c := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		cc.Error = err.Error()
+	} else {
+		cc.Verified = true
+	}
+	return cc
+}
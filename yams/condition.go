@@ -0,0 +1,169 @@
+package yams
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConditionSourceHeader      = "header"
+	ConditionSourceQuery       = "query"
+	ConditionSourceBody        = "body"
+	ConditionSourceContentType = "content_type"
+
+	ConditionOperatorEquals  = "equals"
+	ConditionOperatorRegex   = "regex"
+	ConditionOperatorPresent = "present"
+)
+
+// Maximum size of request body that is read to evaluate body conditions.
+const MaxConditionBodySize = 1 << 20 // 1MB
+
+type RouteCondition struct {
+	Source   string `json:"source" binding:"required,oneof=header query body content_type"`
+	Name     string `json:"name" binding:"omitempty,trim,max=255"`
+	Operator string `json:"operator" binding:"required,oneof=equals regex present"`
+	Value    string `json:"value" binding:"omitempty,max=1024"`
+
+	re *regexp.Regexp
+}
+
+// Compile checks the condition and prepares it for matching.
+func (rc *RouteCondition) Compile() (err error) {
+	switch rc.Source {
+	case ConditionSourceHeader, ConditionSourceQuery, ConditionSourceBody:
+		if rc.Name == "" {
+			return fmt.Errorf(`name is required for "%s" condition`, rc.Source)
+		}
+	case ConditionSourceContentType:
+	default:
+		return fmt.Errorf(`unknown condition source "%s"`, rc.Source)
+	}
+
+	switch rc.Operator {
+	case ConditionOperatorRegex:
+		rc.re, err = regexp.Compile(rc.Value)
+	case ConditionOperatorEquals, ConditionOperatorPresent:
+	default:
+		err = fmt.Errorf(`unknown condition operator "%s"`, rc.Operator)
+	}
+	return
+}
+
+// Match reports whether request satisfies the condition. Decoded JSON body is
+// requested lazily, so it is not read unless body condition is evaluated.
+func (rc *RouteCondition) Match(r *http.Request, body func() interface{}) bool {
+	var values []string
+	switch rc.Source {
+	case ConditionSourceHeader:
+		values = r.Header[textproto.CanonicalMIMEHeaderKey(rc.Name)]
+	case ConditionSourceQuery:
+		values = r.URL.Query()[rc.Name]
+	case ConditionSourceContentType:
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			values = []string{mediaType}
+		}
+	case ConditionSourceBody:
+		if v, ok := JSONPath(body(), rc.Name); ok {
+			values = []string{jsonString(v)}
+		}
+	}
+	if values == nil {
+		return false
+	}
+
+	for _, v := range values {
+		switch rc.Operator {
+		case ConditionOperatorPresent:
+			return true
+		case ConditionOperatorEquals:
+			if v == rc.Value {
+				return true
+			}
+		case ConditionOperatorRegex:
+			if rc.re != nil && rc.re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type RouteConditions []RouteCondition
+
+func (rcs RouteConditions) Compile() error {
+	for i := range rcs {
+		if err := rcs[i].Compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rcs RouteConditions) Match(r *http.Request, body func() interface{}) bool {
+	for i := range rcs {
+		if !rcs[i].Match(r, body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rcs *RouteConditions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, rcs)
+	case string:
+		return json.Unmarshal([]byte(v), rcs)
+	case nil:
+		*rcs = nil
+		return nil
+	}
+	return errors.New("yams: unsupported type for route conditions")
+}
+
+func (rcs RouteConditions) Value() (driver.Value, error) {
+	if rcs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(rcs)
+}
+
+// JSONPath finds value in decoded JSON document by path with dot separated
+// object keys and array indexes, e.g. "items.0.id".
+func JSONPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = vv[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+			v = vv[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,18 @@
+package yams
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadDescriptorSet parses compiled protobuf FileDescriptorSet, e.g. built
+// with "protoc --include_imports --descriptor_set_out".
+func LoadDescriptorSet(data []byte) (*protoregistry.Files, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return nil, err
+	}
+	return protodesc.NewFiles(fds)
+}
@@ -0,0 +1,82 @@
+package yams
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	FaultTypeLatency  = "latency"
+	FaultTypeError    = "error"
+	FaultTypeReset    = "reset"
+	FaultTypeTruncate = "truncate"
+	FaultTypeDrip     = "drip"
+	FaultTypeChunked  = "chunked"
+	FaultTypeHang     = "hang"
+
+	FaultDistUniform     = "uniform"
+	FaultDistNormal      = "normal"
+	FaultDistExponential = "exponential"
+)
+
+// Fault is injected by the proxy into the given percentage of requests.
+// Delay and jitter are in milliseconds: latency is delayed by the random
+// jitter of the distribution, drip writes size bytes per delay, hang lasts
+// for delay or until request times out. Truncated body keeps size bytes.
+type Fault struct {
+	Type         string  `json:"type" binding:"required,oneof=latency error reset truncate drip chunked hang"`
+	Rate         float64 `json:"rate" binding:"required,gt=0,max=100"`
+	Delay        int     `json:"delay,omitempty" binding:"omitempty,min=0,max=3600000"`
+	Jitter       int     `json:"jitter,omitempty" binding:"omitempty,min=0,max=3600000"`
+	Distribution string  `json:"distribution,omitempty" binding:"omitempty,oneof=uniform normal exponential"`
+	Status       int     `json:"status,omitempty" binding:"omitempty,min=500,max=599"`
+	Size         int     `json:"size,omitempty" binding:"omitempty,min=0,max=2147483647"`
+}
+
+// Roll reports whether the fault is injected into the current request.
+func (f Fault) Roll() bool {
+	return rand.Float64()*100 < f.Rate
+}
+
+// Latency returns delay with the random jitter.
+func (f Fault) Latency() time.Duration {
+	var jitter float64
+	switch f.Distribution {
+	case FaultDistNormal:
+		jitter = rand.NormFloat64() * float64(f.Jitter)
+	case FaultDistExponential:
+		jitter = rand.ExpFloat64() * float64(f.Jitter)
+	default:
+		jitter = rand.Float64() * float64(f.Jitter)
+	}
+	d := float64(f.Delay) + jitter
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d * float64(time.Millisecond))
+}
+
+type Faults []Fault
+
+func (fs *Faults) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, fs)
+	case string:
+		return json.Unmarshal([]byte(v), fs)
+	case nil:
+		*fs = nil
+		return nil
+	}
+	return errors.New("yams: unsupported type for faults")
+}
+
+func (fs Faults) Value() (driver.Value, error) {
+	if fs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(fs)
+}
@@ -0,0 +1,99 @@
+package yams
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Collects the backend response, so it can be modified by the script.
+type responseBuffer struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	exceeded bool
+}
+
+func (rb *responseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *responseBuffer) WriteHeader(status int) {
+	if rb.status == 0 {
+		rb.status = status
+	}
+}
+
+func (rb *responseBuffer) Write(p []byte) (int, error) {
+	rb.WriteHeader(http.StatusOK)
+	// body is discarded instead of failing the write, which aborts the handler
+	if rb.exceeded || rb.body.Len()+len(p) > MaxFetchBodySize {
+		rb.exceeded = true
+		return len(p), nil
+	}
+	return rb.body.Write(p)
+}
+
+// Fetch passes request to the backend like ReverseProxy, but returns the
+// backend response instead of writing it to the client.
+func Fetch(ctx context.Context, r *http.Request, backend string, up *Upstream, debug bool) (*http.Response, error) {
+	return fetch(ctx, r, func(w http.ResponseWriter, out *http.Request) error {
+		return reverseProxy(w, out, backend, up, debug, false)
+	})
+}
+
+// Fetch passes request to the selected backend like ReverseProxy, but returns
+// the backend response instead of writing it to the client.
+func (b *Balancer) Fetch(ctx context.Context, r *http.Request, up *Upstream, debug bool) (*http.Response, error) {
+	return fetch(ctx, r, func(w http.ResponseWriter, out *http.Request) error {
+		return b.ReverseProxy(w, out, up, debug)
+	})
+}
+
+func fetch(ctx context.Context, r *http.Request, proxy func(w http.ResponseWriter, out *http.Request) error) (*http.Response, error) {
+	if IsWebSocketRequest(r) {
+		return nil, errors.New("websocket request cannot be fetched")
+	}
+
+	out := r.WithContext(ctx)
+	out.Header = CloneHeader(r.Header)
+	// response is decompressed by the transport, so the script can read it
+	out.Header.Del("Accept-Encoding")
+	if r.Body != nil && r.Body != http.NoBody {
+		// request body is kept for the script
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxFetchBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), r.Body))
+		if len(b) > MaxFetchBodySize {
+			return nil, fmt.Errorf("request body exceeds %d bytes", MaxFetchBodySize)
+		}
+		out.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	rb := &responseBuffer{header: make(http.Header)}
+	// gateway errors of the backend are returned as responses
+	if err := proxy(rb, out); err != nil && err != errBackendStatus {
+		return nil, err
+	}
+	if rb.exceeded {
+		return nil, fmt.Errorf("response body exceeds %d bytes", MaxFetchBodySize)
+	}
+	rb.WriteHeader(http.StatusOK)
+	rb.header.Del(ProxyHeaderStatus)
+	rb.header.Del("Content-Length")
+
+	return &http.Response{
+		Status:        http.StatusText(rb.status),
+		StatusCode:    rb.status,
+		Header:        rb.header,
+		Body:          ioutil.NopCloser(&rb.body),
+		ContentLength: int64(rb.body.Len()),
+		Request:       out,
+	}, nil
+}
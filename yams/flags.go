@@ -8,10 +8,13 @@ import (
 )
 
 var (
-	Mode        = *flag.String("mode", GetEnv("YAMS_MODE", gin.ReleaseMode), "Server mode")
-	ProxyAddr   = *flag.String("proxy-addr", GetEnv("YAMS_PROXY_ADDR", ":8086"), "Proxy server address")
-	ConsoleAddr = *flag.String("console-addr", GetEnv("YAMS_CONSOLE_ADDR", ":8087"), "Console server address")
-	DSN         = *flag.String("dsn", GetEnv("DATABASE_URL", "postgres://localhost"), "Database connection URL")
+	Mode         = *flag.String("mode", GetEnv("YAMS_MODE", gin.ReleaseMode), "Server mode")
+	ProxyAddr    = *flag.String("proxy-addr", GetEnv("YAMS_PROXY_ADDR", ":8086"), "Proxy server address")
+	ProxyTLSAddr = *flag.String("proxy-tls-addr", GetEnv("YAMS_PROXY_TLS_ADDR", ""), "Proxy TLS server address")
+	ConsoleAddr  = *flag.String("console-addr", GetEnv("YAMS_CONSOLE_ADDR", ":8087"), "Console server address")
+	DSN          = *flag.String("dsn", GetEnv("DATABASE_URL", "postgres://localhost"), "Database connection URL")
+	CACertFile   = *flag.String("ca-cert", GetEnv("YAMS_CA_CERT", "yams-ca.crt"), "Local CA certificate file")
+	CAKeyFile    = *flag.String("ca-key", GetEnv("YAMS_CA_KEY", "yams-ca.key"), "Local CA private key file")
 )
 
 func init() {
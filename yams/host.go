@@ -0,0 +1,167 @@
+package yams
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const hostWildcard = "*"
+
+type HostPattern struct {
+	Host   string
+	port   string
+	labels []string
+}
+
+// Parses profile host, which may contain wildcard labels, e.g.
+// "*.api.mock.local", or named labels, e.g. "{tenant}.mock.local". Both match
+// exactly one label of the request host.
+func ParseHost(host string) (*HostPattern, error) {
+	host = strings.ToLower(host)
+	hp := &HostPattern{Host: host}
+
+	name := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		name, hp.port = h, port
+	}
+	hp.labels = strings.Split(name, ".")
+
+	params := make(map[string]bool)
+	for _, label := range hp.labels {
+		if label == "" {
+			return nil, fmt.Errorf(`empty label in host "%s"`, host)
+		}
+		if param := hostParam(label); param != "" {
+			if !pathArgName.MatchString(param) {
+				return nil, fmt.Errorf(`invalid parameter name "%s"`, param)
+			}
+			if params[param] {
+				return nil, fmt.Errorf(`duplicate parameter "%s"`, param)
+			}
+			params[param] = true
+		} else if label != hostWildcard && strings.ContainsAny(label, "*{}") {
+			return nil, fmt.Errorf(`invalid label "%s" in host "%s"`, label, host)
+		}
+	}
+	return hp, nil
+}
+
+func hostParam(label string) string {
+	if len(label) > 2 && label[0] == '{' && label[len(label)-1] == '}' {
+		return label[1 : len(label)-1]
+	}
+	return ""
+}
+
+func (hp *HostPattern) isVariable(i int) bool {
+	return hp.labels[i] == hostWildcard || hostParam(hp.labels[i]) != ""
+}
+
+func (hp *HostPattern) IsPattern() bool {
+	for i := range hp.labels {
+		if hp.isVariable(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Specificity returns number of literal labels in the pattern.
+func (hp *HostPattern) Specificity() int {
+	n := 0
+	for i := range hp.labels {
+		if !hp.isVariable(i) {
+			n++
+		}
+	}
+	return n
+}
+
+// Match returns parameters captured from the host if it matches the pattern.
+func (hp *HostPattern) Match(host string) (map[string]string, bool) {
+	name, port := strings.ToLower(host), ""
+	if h, p, err := net.SplitHostPort(name); err == nil {
+		name, port = h, p
+	}
+	if port != hp.port {
+		return nil, false
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) != len(hp.labels) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, label := range labels {
+		if label == "" {
+			return nil, false
+		}
+		if param := hostParam(hp.labels[i]); param != "" {
+			params[param] = label
+		} else if hp.labels[i] != hostWildcard && hp.labels[i] != label {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Overlaps reports whether both patterns can match the same host with equal
+// specificity, so that the matching profile would be ambiguous.
+func (hp *HostPattern) Overlaps(other *HostPattern) bool {
+	if hp.port != other.port || len(hp.labels) != len(other.labels) || hp.Specificity() != other.Specificity() {
+		return false
+	}
+	for i := range hp.labels {
+		if !hp.isVariable(i) && !other.isVariable(i) && hp.labels[i] != other.labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HostList allows outbound requests of the scripts to the hosts, which match
+// any of the patterns. Pattern without port matches any port of the host.
+type HostList []*HostPattern
+
+func ParseHostList(hosts []string) (HostList, error) {
+	hl := make(HostList, 0, len(hosts))
+	for _, host := range hosts {
+		hp, err := ParseHost(host)
+		if err != nil {
+			return nil, err
+		}
+		hl = append(hl, hp)
+	}
+	return hl, nil
+}
+
+// Allows reports whether the host of URL matches the list. Port is implied by
+// the scheme if it is not given, e.g. "api.local:443" allows "https://api.local/".
+func (hl HostList) Allows(u *url.URL) bool {
+	name, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http", "ws":
+			port = "80"
+		case "https", "wss":
+			port = "443"
+		}
+	}
+	host := name
+	if port != "" {
+		host = net.JoinHostPort(name, port)
+	}
+	for _, hp := range hl {
+		target := host
+		if hp.port == "" {
+			target = name
+		}
+		if _, ok := hp.Match(target); ok {
+			return true
+		}
+	}
+	return false
+}
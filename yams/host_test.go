@@ -0,0 +1,161 @@
+package yams
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		host        string
+		pattern     bool
+		specificity int
+		match       string
+		params      map[string]string
+		noMatch     []string
+	}{
+		{
+			host:        "api.mock.local",
+			specificity: 3,
+			match:       "API.mock.local",
+			params:      map[string]string{},
+			noMatch:     []string{"mock.local", "v1.api.mock.local", "api.mock.local:8086"},
+		},
+		{
+			host:        "*.mock.local",
+			pattern:     true,
+			specificity: 2,
+			match:       "api.mock.local",
+			params:      map[string]string{},
+			noMatch:     []string{"mock.local", "v1.api.mock.local"},
+		},
+		{
+			host:        "{tenant}.mock.local:8086",
+			pattern:     true,
+			specificity: 2,
+			match:       "acme.mock.local:8086",
+			params:      map[string]string{"tenant": "acme"},
+			noMatch:     []string{"acme.mock.local", "acme.mock.local:80"},
+		},
+		{
+			host:        "{version}.{tenant}.mock.local",
+			pattern:     true,
+			specificity: 2,
+			match:       "v1.acme.mock.local",
+			params:      map[string]string{"version": "v1", "tenant": "acme"},
+			noMatch:     []string{"acme.mock.local", "v1..mock.local"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			hp, err := ParseHost(tt.host)
+			if err != nil {
+				t.Fatalf("ParseHost() error = %v", err)
+			}
+			if hp.IsPattern() != tt.pattern {
+				t.Errorf("IsPattern() = %v, want %v", hp.IsPattern(), tt.pattern)
+			}
+			if hp.Specificity() != tt.specificity {
+				t.Errorf("Specificity() = %d, want %d", hp.Specificity(), tt.specificity)
+			}
+			params, ok := hp.Match(tt.match)
+			if !ok {
+				t.Fatalf("%q does not match", tt.match)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("params = %v, want %v", params, tt.params)
+			}
+			for _, host := range tt.noMatch {
+				if _, ok := hp.Match(host); ok {
+					t.Errorf("%q matches", host)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHostErrors(t *testing.T) {
+	tests := []string{
+		"api..local",
+		"*api.mock.local",
+		"{tenant.mock.local",
+		"{tenant}.{tenant}.local",
+		"{ten-ant}.mock.local",
+	}
+
+	for _, host := range tests {
+		t.Run(host, func(t *testing.T) {
+			if _, err := ParseHost(host); err == nil {
+				t.Errorf("ParseHost(%q) error = nil", host)
+			}
+		})
+	}
+}
+
+func TestHostPatternOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		overlaps bool
+	}{
+		{"*.mock.local", "{tenant}.mock.local", true},
+		{"*.api.local", "v1.*.local", true},
+		{"*.mock.local", "*.test.local", false},
+		{"*.mock.local", "*.*.local", false},
+		{"*.mock.local", "*.mock.local:8086", false},
+		{"*.mock.local", "*.v1.mock.local", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := ParseHost(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseHost(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Overlaps(b) != tt.overlaps || b.Overlaps(a) != tt.overlaps {
+				t.Errorf("Overlaps() = %v, want %v", a.Overlaps(b), tt.overlaps)
+			}
+		})
+	}
+}
+
+func TestHostListAllows(t *testing.T) {
+	hl, err := ParseHostList([]string{"api.internal", "secure.internal:443", "plain.internal:80", "*.mock.local:8086"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url    string
+		allows bool
+	}{
+		{"http://api.internal/", true},
+		{"https://api.internal:8443/", true},
+		{"https://secure.internal/", true},
+		{"https://secure.internal:443/", true},
+		{"http://secure.internal/", false},
+		{"http://plain.internal/", true},
+		{"https://plain.internal/", false},
+		{"http://v1.mock.local:8086/", true},
+		{"http://v1.mock.local/", false},
+		{"http://mock.local:8086/", false},
+		{"http://other.internal/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hl.Allows(u) != tt.allows {
+				t.Errorf("Allows() = %v, want %v", hl.Allows(u), tt.allows)
+			}
+		})
+	}
+}
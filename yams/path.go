@@ -0,0 +1,154 @@
+package yams
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	PathTypeString   = "string"
+	PathTypeInt      = "int"
+	PathTypeFloat    = "float"
+	PathTypeRegexp   = "regexp"
+	PathTypeCatchAll = "path"
+)
+
+var PathTypes = map[string]string{
+	PathTypeString: `[^/]+`,
+	PathTypeInt:    `-?[0-9]+`,
+	PathTypeFloat:  `-?[0-9]*\.?[0-9]+`,
+	"uuid":         `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha":        `[a-zA-Z]+`,
+	"alnum":        `[a-zA-Z0-9]+`,
+}
+
+var pathArgName = regexp.MustCompile(`^\w+$`)
+
+type PathArg struct {
+	Name    string
+	Type    string
+	Pattern string
+}
+
+// Value converts matched string to the typed value of the argument.
+func (a PathArg) Value(s string) interface{} {
+	switch a.Type {
+	case PathTypeInt:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case PathTypeFloat:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+type PathPattern struct {
+	Regexp   *regexp.Regexp
+	Args     []PathArg
+	Template string // path with unconstrained parameters, e.g. "/users/{id}"
+}
+
+func (pp *PathPattern) ArgNames() []string {
+	names := make([]string, len(pp.Args))
+	for i, arg := range pp.Args {
+		names[i] = arg.Name
+	}
+	return names
+}
+
+// Parses route path with parameters in curly braces. Parameters match single
+// path segment by default, e.g. "{id}", and can be constrained with a type or
+// regular expression, e.g. "{id:int}", "{slug:[a-z-]+}", or match the rest of
+// the path, e.g. "{rest...}".
+func ParsePath(path string) (*PathPattern, error) {
+	pp := &PathPattern{}
+	re := bytes.NewBufferString("^")
+	tpl := &bytes.Buffer{}
+
+	for i := 0; i < len(path); {
+		start := strings.IndexByte(path[i:], '{')
+		if start < 0 {
+			re.WriteString(regexp.QuoteMeta(path[i:]))
+			tpl.WriteString(path[i:])
+			break
+		}
+		start += i
+		re.WriteString(regexp.QuoteMeta(path[i:start]))
+		tpl.WriteString(path[i:start])
+
+		end, depth := start+1, 1
+		for ; end < len(path) && depth > 0; end++ {
+			switch path[end] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+		}
+		if depth > 0 {
+			return nil, fmt.Errorf("unclosed parameter at position %d", start)
+		}
+
+		arg, expr, err := parsePathArg(path[start+1 : end-1])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range pp.Args {
+			if a.Name == arg.Name {
+				return nil, fmt.Errorf(`duplicate parameter "%s"`, arg.Name)
+			}
+		}
+		pp.Args = append(pp.Args, arg)
+		re.WriteString("(" + expr + ")")
+		tpl.WriteString("{" + arg.Name + "}")
+		i = end
+	}
+	re.WriteString("$")
+	pp.Template = tpl.String()
+
+	var err error
+	if pp.Regexp, err = regexp.Compile(re.String()); err != nil {
+		return nil, err
+	}
+	return pp, nil
+}
+
+func parsePathArg(s string) (arg PathArg, expr string, err error) {
+	arg.Name, expr = s, ""
+	if index := strings.IndexByte(s, ':'); index >= 0 {
+		arg.Name, expr = s[:index], s[index+1:]
+	}
+
+	if strings.HasSuffix(arg.Name, "...") {
+		if expr != "" {
+			return arg, "", fmt.Errorf(`catch-all parameter "%s" cannot be constrained`, arg.Name)
+		}
+		arg.Name, arg.Type = strings.TrimSuffix(arg.Name, "..."), PathTypeCatchAll
+		expr = `.*`
+	} else if expr == "" {
+		arg.Type, expr = PathTypeString, PathTypes[PathTypeString]
+	} else if v, ok := PathTypes[expr]; ok {
+		arg.Type, expr = expr, v
+	} else {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return arg, "", fmt.Errorf(`invalid pattern for parameter "%s": %v`, arg.Name, err)
+		}
+		if re.NumSubexp() > 0 {
+			return arg, "", fmt.Errorf(`pattern for parameter "%s" must use non-capturing groups`, arg.Name)
+		}
+		arg.Type = PathTypeRegexp
+	}
+	arg.Pattern = expr
+
+	if !pathArgName.MatchString(arg.Name) {
+		return arg, "", fmt.Errorf(`invalid parameter name "%s"`, arg.Name)
+	}
+	return arg, expr, nil
+}
@@ -0,0 +1,137 @@
+package yams
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		template string
+		args     []PathArg
+		match    string
+		values   []interface{}
+		noMatch  []string
+	}{
+		{
+			path:     "/users",
+			template: "/users",
+			match:    "/users",
+			noMatch:  []string{"/users/", "/users/1"},
+		},
+		{
+			path:     "/users/{id}",
+			template: "/users/{id}",
+			args:     []PathArg{{"id", PathTypeString, `[^/]+`}},
+			match:    "/users/john",
+			values:   []interface{}{"john"},
+			noMatch:  []string{"/users/", "/users/john/posts"},
+		},
+		{
+			path:     "/users/{id:int}",
+			template: "/users/{id}",
+			args:     []PathArg{{"id", PathTypeInt, `-?[0-9]+`}},
+			match:    "/users/-42",
+			values:   []interface{}{int64(-42)},
+			noMatch:  []string{"/users/john", "/users/4.2"},
+		},
+		{
+			path:     "/prices/{value:float}",
+			template: "/prices/{value}",
+			args:     []PathArg{{"value", PathTypeFloat, `-?[0-9]*\.?[0-9]+`}},
+			match:    "/prices/.5",
+			values:   []interface{}{0.5},
+			noMatch:  []string{"/prices/free"},
+		},
+		{
+			path:     "/items/{id:uuid}",
+			template: "/items/{id}",
+			args:     []PathArg{{"id", "uuid", PathTypes["uuid"]}},
+			match:    "/items/3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			values:   []interface{}{"3fa85f64-5717-4562-b3fc-2c963f66afa6"},
+			noMatch:  []string{"/items/3fa85f64"},
+		},
+		{
+			path:     "/posts/{slug:[a-z-]+}/{page:int}",
+			template: "/posts/{slug}/{page}",
+			args:     []PathArg{{"slug", PathTypeRegexp, `[a-z-]+`}, {"page", PathTypeInt, `-?[0-9]+`}},
+			match:    "/posts/hello-world/2",
+			values:   []interface{}{"hello-world", int64(2)},
+			noMatch:  []string{"/posts/Hello/2", "/posts/hello/two"},
+		},
+		{
+			path:     "/files/{year:(?:19|20)[0-9]{2}}",
+			template: "/files/{year}",
+			args:     []PathArg{{"year", PathTypeRegexp, `(?:19|20)[0-9]{2}`}},
+			match:    "/files/2020",
+			values:   []interface{}{"2020"},
+			noMatch:  []string{"/files/1820"},
+		},
+		{
+			path:     "/static/{rest...}",
+			template: "/static/{rest}",
+			args:     []PathArg{{"rest", PathTypeCatchAll, `.*`}},
+			match:    "/static/css/app.css",
+			values:   []interface{}{"css/app.css"},
+			noMatch:  []string{"/assets/app.css"},
+		},
+		{
+			path:     "/a.b/{id}",
+			template: "/a.b/{id}",
+			args:     []PathArg{{"id", PathTypeString, `[^/]+`}},
+			match:    "/a.b/1",
+			values:   []interface{}{"1"},
+			noMatch:  []string{"/axb/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			pp, err := ParsePath(tt.path)
+			if err != nil {
+				t.Fatalf("ParsePath() error = %v", err)
+			}
+			if pp.Template != tt.template {
+				t.Errorf("Template = %q, want %q", pp.Template, tt.template)
+			}
+			if len(pp.Args) != len(tt.args) || (len(tt.args) > 0 && !reflect.DeepEqual(pp.Args, tt.args)) {
+				t.Errorf("Args = %v, want %v", pp.Args, tt.args)
+			}
+
+			pv := pp.Regexp.FindStringSubmatch(tt.match)
+			if pv == nil {
+				t.Fatalf("%q does not match", tt.match)
+			}
+			for i, arg := range pp.Args {
+				if v := arg.Value(pv[i+1]); v != tt.values[i] {
+					t.Errorf("%s = %#v, want %#v", arg.Name, v, tt.values[i])
+				}
+			}
+			for _, path := range tt.noMatch {
+				if pp.Regexp.MatchString(path) {
+					t.Errorf("%q matches", path)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	tests := []string{
+		"/users/{id",
+		"/users/{id}/{id:int}",
+		"/users/{user-id}",
+		"/users/{id:[}",
+		"/users/{id:(a|b)}",
+		"/files/{rest...:int}",
+	}
+
+	for _, path := range tests {
+		t.Run(path, func(t *testing.T) {
+			if _, err := ParsePath(path); err == nil {
+				t.Errorf("ParsePath(%q) error = nil", path)
+			}
+		})
+	}
+}
@@ -1,29 +1,218 @@
 package yams
 
 import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
+	"time"
 )
 
 const (
 	ProxyHeaderStatus    = "X-YAMS-Status"
 	ProxyHeaderRouteId   = "X-YAMS-Route-Id"
 	ProxyHeaderSessionId = "X-YAMS-Session-Id"
+	ProxyHeaderViolation = "X-YAMS-Violation"
+	ProxyHeaderFault     = "X-YAMS-Fault"
+	ProxyHeaderBackend   = "X-YAMS-Backend"
 
 	ProxyStatusError       = "error"
 	ProxyStatusProxy       = "proxy"
 	ProxyStatusIntercepted = "intercepted"
 )
 
-func ReverseProxy(w http.ResponseWriter, r *http.Request, backend string, debug bool) {
+const proxyDialTimeout = 30 * time.Second
+
+// ProxiedWriter is implemented by response writers that need to know if the
+// response was passed to the backend.
+type ProxiedWriter interface {
+	SetProxied(backend string)
+}
+
+// ThrottledWriter is implemented by response writers that limit bandwidth.
+type ThrottledWriter interface {
+	SetRate(rate int, ttfb time.Duration)
+}
+
+// ReverseProxy passes request to the backend with upstream settings of the
+// profile, which may be nil.
+func ReverseProxy(w http.ResponseWriter, r *http.Request, backend string, up *Upstream, debug bool) {
+	reverseProxy(w, r, backend, up, debug, false)
+}
+
+// Passes request to the backend and returns error if the backend is not
+// available. If retry is set, nothing is written to the response on error,
+// so the request may be passed to another backend.
+func reverseProxy(w http.ResponseWriter, r *http.Request, backend string, up *Upstream, debug, retry bool) error {
 	u, err := url.Parse(backend)
 	if err != nil {
 		panic(err)
 	}
 	r.Host = u.Host
+	if pw, ok := w.(ProxiedWriter); ok {
+		pw.SetProxied(u.String())
+	}
 	if debug {
 		w.Header().Set(ProxyHeaderStatus, ProxyStatusProxy)
+		w.Header().Set(ProxyHeaderBackend, u.String())
+	}
+	if IsWebSocketRequest(r) {
+		return proxyWebSocket(w, r, u, up, retry)
+	}
+
+	rp := httputil.NewSingleHostReverseProxy(u)
+	director := rp.Director
+	rp.Director = func(out *http.Request) {
+		// prefixes are applied to the request path before backend path
+		up.rewritePath(out.URL)
+		director(out)
+		up.rewriteRequestHeader(out.Header)
 	}
-	httputil.NewSingleHostReverseProxy(u).ServeHTTP(w, r)
+	rp.ModifyResponse = func(res *http.Response) error {
+		if isBackendFailure(res.StatusCode) {
+			err = errBackendStatus
+			if retry {
+				return err
+			}
+		}
+		up.rewriteResponseHeader(res.Header)
+		return nil
+	}
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, e error) {
+		err = e
+		if !retry {
+			log.Printf("yams: proxy error: %v", e)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	rp.Transport = up.transport()
+	rp.ServeHTTP(w, r)
+	return err
+}
+
+// Tunnels WebSocket connection to the backend, after the handshake response
+// is received.
+func proxyWebSocket(w http.ResponseWriter, r *http.Request, u *url.URL, up *Upstream, retry bool) error {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("yams: unable to hijack response writer")
+	}
+
+	host := u.Host
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if secure {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	var bc net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: up.dialTimeout()}
+	if secure {
+		c := up.tlsConfig()
+		if c == nil {
+			c = &tls.Config{}
+		}
+		c.ServerName = u.Hostname()
+		bc, err = tls.DialWithDialer(dialer, "tcp", host, c)
+	} else {
+		bc, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		if !retry {
+			log.Printf("yams: websocket proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return err
+	}
+	defer bc.Close()
+
+	out := new(http.Request)
+	*out = *r
+	path := &url.URL{Path: r.URL.Path}
+	up.rewritePath(path)
+	out.URL = &url.URL{
+		Path:     strings.TrimSuffix(u.Path, "/") + path.Path,
+		RawQuery: u.RawQuery,
+	}
+	if out.URL.RawQuery == "" || r.URL.RawQuery == "" {
+		out.URL.RawQuery += r.URL.RawQuery
+	} else {
+		out.URL.RawQuery += "&" + r.URL.RawQuery
+	}
+	out.Header = CloneHeader(r.Header)
+	if ip := ClientIP(r); ip != "" {
+		if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+	up.rewriteRequestHeader(out.Header)
+	if err = out.Write(bc); err != nil {
+		if !retry {
+			log.Printf("yams: websocket proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return err
+	}
+
+	br := bufio.NewReader(bc)
+	res, err := http.ReadResponse(br, out)
+	if err != nil {
+		if !retry {
+			log.Printf("yams: websocket proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	if retry && isBackendFailure(res.StatusCode) {
+		return errBackendStatus
+	}
+
+	up.rewriteResponseHeader(res.Header)
+	for k, vv := range res.Header {
+		w.Header()[k] = vv
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		// handshake was rejected by the backend
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+		return nil
+	}
+
+	cc, buf, err := hj.Hijack()
+	if err != nil {
+		panic(err)
+	}
+	defer cc.Close()
+
+	fmt.Fprintf(buf, "HTTP/1.1 %s\r\n", res.Status)
+	w.Header().Write(buf)
+	buf.WriteString("\r\n")
+	if err = buf.Flush(); err != nil {
+		return nil
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		// client data may be already buffered by the server
+		_, err := io.Copy(bc, buf.Reader)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(cc, br)
+		errc <- err
+	}()
+	<-errc
+	return nil
 }
@@ -24,3 +24,16 @@ func ClientIP(r *http.Request) string {
 	}
 	return ""
 }
+
+// IsWebSocketRequest reports whether the request is a WebSocket handshake.
+func IsWebSocketRequest(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
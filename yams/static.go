@@ -0,0 +1,82 @@
+package yams
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Maximum delay of the static response in milliseconds.
+const MaxStaticDelay = 3600000
+
+// StaticResponse is the declarative route document, which is served by the
+// proxy without script, e.g.:
+//
+//	{"status": 200, "headers": {"Content-Type": "application/json"}, "body": "{}", "delay": 500}
+type StaticResponse struct {
+	Status  int          `json:"status,omitempty"`
+	Headers StaticHeader `json:"headers,omitempty"`
+	Body    string       `json:"body,omitempty"`
+	Asset   string       `json:"asset,omitempty"`
+	Delay   int          `json:"delay,omitempty"` // in milliseconds
+}
+
+// StaticHeader accepts single string or list of strings per header name.
+type StaticHeader http.Header
+
+func (h *StaticHeader) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*h = make(StaticHeader, len(m))
+	for k, raw := range m {
+		var vv []string
+		if err := json.Unmarshal(raw, &vv); err != nil {
+			var v string
+			if err = json.Unmarshal(raw, &v); err != nil {
+				return errors.New("header values must be strings")
+			}
+			vv = []string{v}
+		}
+		http.Header(*h)[http.CanonicalHeaderKey(k)] = vv
+	}
+	return nil
+}
+
+func (h StaticHeader) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(h))
+	for k, vv := range h {
+		if len(vv) == 1 {
+			m[k] = vv[0]
+		} else {
+			m[k] = vv
+		}
+	}
+	return json.Marshal(m)
+}
+
+// ParseStatic decodes and validates static route document.
+func ParseStatic(data []byte) (*StaticResponse, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	sr := &StaticResponse{}
+	if err := dec.Decode(sr); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the document")
+	}
+	if sr.Status != 0 && (sr.Status < 100 || sr.Status > 599) {
+		return nil, errors.New("status must be between 100 and 599")
+	}
+	if sr.Delay < 0 || sr.Delay > MaxStaticDelay {
+		return nil, errors.New("delay must be between 0 and 3600000 milliseconds")
+	}
+	if sr.Body != "" && sr.Asset != "" {
+		return nil, errors.New("body and asset cannot be both defined")
+	}
+	return sr, nil
+}
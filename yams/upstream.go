@@ -0,0 +1,151 @@
+package yams
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderRules remove headers and then add values to them.
+type HeaderRules struct {
+	Remove []string          `json:"remove,omitempty" binding:"omitempty,max=32,dive,required,max=128"`
+	Add    map[string]string `json:"add,omitempty" binding:"omitempty,max=32"`
+}
+
+func (hr HeaderRules) apply(h http.Header) {
+	for _, k := range hr.Remove {
+		h.Del(k)
+	}
+	for k, v := range hr.Add {
+		h.Add(k, v)
+	}
+}
+
+// Upstream configures requests, which are passed to the backend of the
+// profile. Timeouts are in milliseconds, and CA is the path of the asset
+// with PEM bundle, which is trusted for the backend certificates.
+type Upstream struct {
+	RequestHeaders     HeaderRules `json:"request_headers"`
+	ResponseHeaders    HeaderRules `json:"response_headers"`
+	StripPrefix        string      `json:"strip_prefix,omitempty" binding:"omitempty,max=128"`
+	AddPrefix          string      `json:"add_prefix,omitempty" binding:"omitempty,max=128"`
+	ConnectTimeout     int         `json:"connect_timeout,omitempty" binding:"omitempty,min=0,max=3600000"`
+	ResponseTimeout    int         `json:"response_timeout,omitempty" binding:"omitempty,min=0,max=3600000"`
+	InsecureSkipVerify bool        `json:"insecure_skip_verify,omitempty"`
+	CA                 string      `json:"ca,omitempty" binding:"omitempty,max=72"`
+
+	// CAData is loaded from the CA asset.
+	CAData []byte `json:"-"`
+}
+
+func (up *Upstream) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, up)
+	case string:
+		return json.Unmarshal([]byte(v), up)
+	case nil:
+		*up = Upstream{}
+		return nil
+	}
+	return errors.New("yams: unsupported type for upstream")
+}
+
+func (up Upstream) Value() (driver.Value, error) {
+	return json.Marshal(up)
+}
+
+// Rewrites request path with the prefixes.
+func (up *Upstream) rewritePath(u *url.URL) {
+	if up == nil || (up.StripPrefix == "" && up.AddPrefix == "") {
+		return
+	}
+	p := u.Path
+	if up.StripPrefix != "" && strings.HasPrefix(p, up.StripPrefix) {
+		if p = strings.TrimPrefix(p, up.StripPrefix); !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+	}
+	if up.AddPrefix != "" {
+		p = "/" + strings.Trim(up.AddPrefix, "/") + p
+	}
+	u.Path, u.RawPath = p, ""
+}
+
+func (up *Upstream) rewriteRequestHeader(h http.Header) {
+	if up != nil {
+		up.RequestHeaders.apply(h)
+	}
+}
+
+func (up *Upstream) rewriteResponseHeader(h http.Header) {
+	if up != nil {
+		up.ResponseHeaders.apply(h)
+	}
+}
+
+func (up *Upstream) dialTimeout() time.Duration {
+	if up == nil || up.ConnectTimeout == 0 {
+		return proxyDialTimeout
+	}
+	return time.Duration(up.ConnectTimeout) * time.Millisecond
+}
+
+func (up *Upstream) tlsConfig() *tls.Config {
+	if up == nil || (!up.InsecureSkipVerify && up.CAData == nil) {
+		return nil
+	}
+	c := &tls.Config{InsecureSkipVerify: up.InsecureSkipVerify}
+	if up.CAData != nil {
+		c.RootCAs = x509.NewCertPool()
+		c.RootCAs.AppendCertsFromPEM(up.CAData)
+	}
+	return c
+}
+
+// Transports are shared by the profiles with the same settings, so the
+// connections to the backends are pooled.
+var upstreamTransports = struct {
+	sync.Mutex
+	m map[string]*http.Transport
+}{m: make(map[string]*http.Transport)}
+
+func (up *Upstream) transport() http.RoundTripper {
+	if up == nil || (up.ConnectTimeout == 0 && up.ResponseTimeout == 0 && up.tlsConfig() == nil) {
+		return http.DefaultTransport
+	}
+
+	key := fmt.Sprintf("%d:%d:%t:%x", up.ConnectTimeout, up.ResponseTimeout, up.InsecureSkipVerify, sha1.Sum(up.CAData))
+	upstreamTransports.Lock()
+	defer upstreamTransports.Unlock()
+
+	t, ok := upstreamTransports.m[key]
+	if !ok {
+		t = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   up.dialTimeout(),
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       up.tlsConfig(),
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			ResponseHeaderTimeout: time.Duration(up.ResponseTimeout) * time.Millisecond,
+		}
+		upstreamTransports.m[key] = t
+	}
+	return t
+}
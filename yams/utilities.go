@@ -2,6 +2,7 @@ package yams
 
 import (
 	"math/rand"
+	"net/http"
 	"time"
 	"unicode"
 )
@@ -52,6 +53,14 @@ func IsTextString(s string) bool {
 	return !IsBinaryString(s)
 }
 
+func CloneHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, vv := range h {
+		out[k] = append([]string(nil), vv...)
+	}
+	return out
+}
+
 func InStringSlice(slice []string, x string) bool {
 	for _, s := range slice {
 		if x == s {
@@ -62,27 +62,71 @@ func (v *defaultValidator) lazyinit() {
 			if !strings.Contains(host, ":") {
 				host += ":80"
 			}
-			if _, err := net.ResolveTCPAddr("tcp", host); err != nil {
-				return false
-			}
 
 			// allow HTTP and HTTPS by default
-			host = strings.TrimSuffix(host, ":80")
-			host = strings.TrimSuffix(host, ":443")
+			hp, err := ParseHost(strings.TrimSuffix(strings.TrimSuffix(host, ":80"), ":443"))
+			if err != nil {
+				return false
+			}
+			if !hp.IsPattern() {
+				if _, err := net.ResolveTCPAddr("tcp", host); err != nil {
+					return false
+				}
+			}
 
 			if idField := reflect.Indirect(fl.Top()).FieldByName("id"); idField.IsValid() {
-				q := QB.Select("TRUE").From("profiles").Where("? = ANY(hosts)", host)
+				if !hp.IsPattern() {
+					q := QB.Select("TRUE").From("profiles").Where("? = ANY(hosts)", hp.Host)
+					if id := idField.Int(); id != 0 {
+						q.Where("id <> ?", id)
+					}
+					if err := q.Scan(new(bool)); err == nil {
+						return false
+					} else if err != sql.ErrNoRows {
+						panic(err)
+					}
+					return true
+				}
+
+				// patterns of equal specificity must not match the same host
+				q := QB.Select("host").From("profiles, unnest(hosts) AS host").Where("host ~ '[*{]'")
 				if id := idField.Int(); id != 0 {
 					q.Where("id <> ?", id)
 				}
-				if err := q.Scan(new(bool)); err == nil {
-					return false
-				} else if err != sql.ErrNoRows {
+				rows, err := q.Query()
+				if err != nil {
+					panic(err)
+				}
+				defer rows.Close()
+				for rows.Next() {
+					var other string
+					if err = rows.Scan(&other); err != nil {
+						panic(err)
+					}
+					if op, err := ParseHost(other); err == nil && hp.Overlaps(op) {
+						return false
+					}
+				}
+				if err = rows.Err(); err != nil {
 					panic(err)
 				}
 			}
 			return true
 		})
+		v.validate.RegisterValidation("hostpattern", func(fl validator.FieldLevel) bool {
+			_, err := ParseHost(fl.Field().String())
+			return err == nil
+		})
+		v.validate.RegisterValidation("path", func(fl validator.FieldLevel) bool {
+			_, err := ParsePath(fl.Field().String())
+			return err == nil
+		})
+		v.validate.RegisterValidation("condition", func(fl validator.FieldLevel) bool {
+			if rc, ok := fl.Field().Interface().(RouteCondition); ok {
+				return rc.Compile() == nil
+			}
+			return false
+		})
 		v.validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
 			return regexp.MustCompile(`^[a-z][a-z0-9.]{2,31}$`).MatchString(fl.Field().String())
 		})
@@ -7,6 +7,9 @@ import (
 const MaxScriptSize = 8 << 20 // 8MB
 const MaxAssetSize = 64 << 20 // 64MB
 
+const MaxJournalBodySize = 64 << 10 // 64KB
+const MaxFetchBodySize = 10 << 20   // 10MB
+
 var SecretKey = RandBytes(32)
 var Debug = Mode == gin.DebugMode
 